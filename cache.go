@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+)
+
+// panelInfoCacheTTL is how long cached panel info is used before it is
+// fetched from the Nanoleaf again.
+const panelInfoCacheTTL = 30 * time.Second
+
+// staticPanelInfo holds the parts of the panel info that rarely change, and
+// so are safe to cache. The state, effects, and layout are always fetched
+// from the Nanoleaf.
+type staticPanelInfo struct {
+	Name                  string `json:"name"`
+	SerialNo              string `json:"serialNo"`
+	Manufacturer          string `json:"manufacturer"`
+	FirmwareVersion       string `json:"firmwareVersion"`
+	Model                 string `json:"model"`
+	RhythmHardwareVersion string `json:"rhythmHardwareVersion"`
+	RhythmFirmwareVersion string `json:"rhythmFirmwareVersion"`
+}
+
+// panelInfo returns the cached fields as a partially filled PanelInfo.
+func (s *staticPanelInfo) panelInfo() *nanoleaf.PanelInfo {
+	return &nanoleaf.PanelInfo{
+		Name:            s.Name,
+		SerialNo:        s.SerialNo,
+		Manufacturer:    s.Manufacturer,
+		FirmwareVersion: s.FirmwareVersion,
+		Model:           s.Model,
+		Rhythm: nanoleaf.Rhythm{
+			HardwareVersion: s.RhythmHardwareVersion,
+			FirmwareVersion: s.RhythmFirmwareVersion,
+		},
+	}
+}
+
+// cachedPanelInfo returns the Nanoleaf's static panel info, from the on-disk
+// cache if it is fresher than panelInfoCacheTTL, or else from the Nanoleaf.
+// Cache errors are logged and otherwise ignored.
+func cachedPanelInfo(ctx context.Context, client *nanoleaf.Client) (*nanoleaf.PanelInfo, error) {
+	path, err := hostCachePath(client.Host, ".json")
+	if err != nil {
+		slog.Debug("panel info cache unavailable", "err", err)
+	}
+
+	if path != "" && !*noCache {
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) < panelInfoCacheTTL {
+			data, err := os.ReadFile(path)
+			var cached staticPanelInfo
+			if err == nil {
+				err = json.Unmarshal(data, &cached)
+			}
+			if err == nil {
+				slog.Debug("using cached panel info", "path", path)
+				return cached.panelInfo(), nil
+			}
+			slog.Debug("failed to read panel info cache", "path", path, "err", err)
+		}
+	}
+
+	panelInfo, err := client.GetPanelInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := json.Marshal(staticPanelInfo{
+			Name:                  panelInfo.Name,
+			SerialNo:              panelInfo.SerialNo,
+			Manufacturer:          panelInfo.Manufacturer,
+			FirmwareVersion:       panelInfo.FirmwareVersion,
+			Model:                 panelInfo.Model,
+			RhythmHardwareVersion: panelInfo.Rhythm.HardwareVersion,
+			RhythmFirmwareVersion: panelInfo.Rhythm.FirmwareVersion,
+		})
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0700)
+		}
+		if err == nil {
+			err = os.WriteFile(path, data, 0600)
+		}
+		if err != nil {
+			slog.Debug("failed to write panel info cache", "path", path, "err", err)
+		}
+	}
+	return panelInfo, nil
+}
+
+// invalidatePanelInfoCache removes any cached panel info for host, e.g.
+// after renaming the panel.
+func invalidatePanelInfoCache(host string) {
+	path, err := hostCachePath(host, ".json")
+	if err != nil {
+		return
+	}
+	os.Remove(path)
+}
+
+// hostCachePath returns the path of a file for host with the given
+// extension, under the user's cache directory: the panel info cache is
+// ".json", and the lock file used by -min-interval is ".lock".
+func hostCachePath(host, ext string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(host)
+	return filepath.Join(dir, "microleaf", name+ext), nil
+}
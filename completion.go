@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commands lists the top-level commands, for shell completion.
+var commands = []string{
+	"brightness", "completion", "delete", "discover", "effect", "fade",
+	"flash", "get", "gradient", "hsl", "hsv", "hue", "identify", "off",
+	"on", "pair", "panel", "ping", "post", "pulse", "put", "rainbow",
+	"restore", "rgb", "run", "sat", "save", "scene", "serve-metrics",
+	"status", "sunrise", "sunset", "temp", "toggle", "touch", "version",
+	"watch", "wipe",
+}
+
+// effectCommands and panelCommands list the `effect` and `panel`
+// subcommands, for shell completion.
+var (
+	effectCommands = []string{"create", "current", "custom", "delete", "export", "import", "list", "loop", "next", "prev", "random", "select", "show"}
+	panelCommands  = []string{"blink", "firmware", "info", "layout", "map", "mode", "model", "name", "orientation", "reboot", "rename", "serial", "state", "version"}
+)
+
+// completionShells lists the shells `completion` can generate scripts for.
+var completionShells = []string{"bash", "fish", "zsh"}
+
+const bashCompletion = `_microleaf() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+        -n)
+            COMPREPLY=($(compgen -W "$(microleaf completion panels 2>/dev/null) all" -- "$cur"))
+            return
+            ;;
+        effect)
+            COMPREPLY=($(compgen -W "{{effect}}" -- "$cur"))
+            return
+            ;;
+        panel)
+            COMPREPLY=($(compgen -W "{{panel}}" -- "$cur"))
+            return
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "{{shells}}" -- "$cur"))
+            return
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "{{flags}}" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -W "{{commands}}" -- "$cur"))
+    fi
+}
+
+complete -F _microleaf microleaf
+`
+
+const zshCompletion = `#compdef microleaf
+
+_microleaf() {
+    case "${words[CURRENT-1]}" in
+        -n)
+            compadd -- ${(f)"$(microleaf completion panels 2>/dev/null)"} all
+            return
+            ;;
+        effect)
+            compadd -- {{effect}}
+            return
+            ;;
+        panel)
+            compadd -- {{panel}}
+            return
+            ;;
+        completion)
+            compadd -- {{shells}}
+            return
+            ;;
+    esac
+
+    if [[ "$PREFIX" == -* ]]; then
+        compadd -- {{flags}}
+    else
+        compadd -- {{commands}}
+    fi
+}
+
+compdef _microleaf microleaf
+`
+
+const fishCompletion = `complete -c microleaf -f
+complete -c microleaf -o n -x -a '(microleaf completion panels 2>/dev/null; echo all)' -d 'Panel name'
+complete -c microleaf -n 'not __fish_seen_subcommand_from {{commands}}' -a '{{commands}}'
+complete -c microleaf -n '__fish_seen_subcommand_from effect' -a '{{effect}}'
+complete -c microleaf -n '__fish_seen_subcommand_from panel' -a '{{panel}}'
+complete -c microleaf -n '__fish_seen_subcommand_from completion' -a '{{shells}}'
+`
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "fish":
+		script = fishCompletion
+	case "zsh":
+		script = zshCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+
+	var flags []string
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+
+	replacer := strings.NewReplacer(
+		"{{commands}}", strings.Join(commands, " "),
+		"{{effect}}", strings.Join(effectCommands, " "),
+		"{{panel}}", strings.Join(panelCommands, " "),
+		"{{shells}}", strings.Join(completionShells, " "),
+		"{{flags}}", strings.Join(flags, " "),
+	)
+	_, err := replacer.WriteString(w, script)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// waitForHost spaces out commands sent to host by different microleaf
+// invocations, so that they queue rather than race on the Nanoleaf. It takes
+// an exclusive lock on the host's lock file, waits until at least interval
+// has passed since the last command started, and records this one as
+// starting now. The lock is only held while waiting, so long-running
+// commands like watch don't block later ones for their whole duration.
+func waitForHost(ctx context.Context, host string, interval time.Duration) error {
+	path, err := hostCachePath(host, ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to find lock file: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create lock file: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer f.Close()
+
+	// Closing the file releases the lock.
+	err = lockFile(f)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// The lock file's modification time is when the last command started.
+	// A newly created lock file has just been modified, but hasn't been
+	// used by a command yet.
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read lock file: %w", err)
+	}
+	if info.Size() > 0 {
+		if wait := interval - time.Since(info.ModTime()); wait > 0 {
+			slog.Debug("waiting for previous command", "host", host, "wait", wait)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	// Write the time, rather than only touching the file, so that a
+	// non-empty file marks it as used.
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt([]byte(time.Now().Format(time.RFC3339Nano)+"\n"), 0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update lock file: %w", err)
+	}
+	return nil
+}
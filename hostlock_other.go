@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile is a no-op where flock isn't available, so only the minimum
+// interval is enforced, not the queueing.
+func lockFile(f *os.File) error {
+	return nil
+}
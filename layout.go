@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+)
+
+// mapWidth and mapHeight bound the size, in characters, of a rendered panel
+// layout map.
+const (
+	mapWidth  = 72
+	mapHeight = 36
+)
+
+// orientationIndicators marks a panel's orientation on a layout map, in
+// 45° steps starting from 0°.
+var orientationIndicators = []string{"^", "/", ">", "\\", "v", "/", "<", "\\"}
+
+// renderLayoutMap draws the panels in layout as a rough ASCII grid, placing
+// each panel's ID at its scaled position and marking its orientation.
+func renderLayoutMap(layout *nanoleaf.Layout) string {
+	if len(layout.PositionData) == 0 {
+		return ""
+	}
+
+	minX, maxX := math.MaxInt, math.MinInt
+	minY, maxY := math.MaxInt, math.MinInt
+	for _, panel := range layout.PositionData {
+		minX, maxX = min(minX, panel.X), max(maxX, panel.X)
+		minY, maxY = min(minY, panel.Y), max(maxY, panel.Y)
+	}
+
+	labels := make([]string, len(layout.PositionData))
+	labelWidth := 0
+	for i, panel := range layout.PositionData {
+		step := ((panel.O%360+360)%360 + 22) / 45 % len(orientationIndicators)
+		labels[i] = fmt.Sprintf("%d%s", panel.PanelID, orientationIndicators[step])
+		labelWidth = max(labelWidth, len(labels[i]))
+	}
+
+	// Terminal cells are roughly twice as tall as they are wide, so use
+	// half as many rows as columns for the same distance.
+	scale := math.Min(
+		float64(mapWidth-labelWidth)/float64(max(maxX-minX, 1)),
+		float64(2*(mapHeight-1))/float64(max(maxY-minY, 1)),
+	)
+	rows := int(math.Round(float64(maxY-minY)*scale/2)) + 1
+
+	grid := make([][]byte, rows)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(" ", mapWidth))
+	}
+
+	for i, panel := range layout.PositionData {
+		col := int(math.Round(float64(panel.X-minX) * scale))
+		// Panel Y coordinates increase upwards, unlike terminal rows.
+		row := int(math.Round(float64(maxY-panel.Y) * scale / 2))
+		row = min(row, rows-1)
+		copy(grid[row][col:], labels[i])
+	}
+
+	var b strings.Builder
+	for _, line := range grid {
+		b.WriteString(strings.TrimRight(string(line), " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// panelsAlong returns the layout's panels ordered by their position along
+// axis, which is either "x" or "y".
+func panelsAlong(layout *nanoleaf.Layout, axis string) ([]nanoleaf.PanelPosition, error) {
+	var coord func(nanoleaf.PanelPosition) int
+	switch axis {
+	case "x":
+		coord = func(panel nanoleaf.PanelPosition) int { return panel.X }
+	case "y":
+		coord = func(panel nanoleaf.PanelPosition) int { return panel.Y }
+	default:
+		return nil, fmt.Errorf("invalid axis %q: expected x or y", axis)
+	}
+
+	panels := slices.Clone(layout.PositionData)
+	slices.SortStableFunc(panels, func(a, b nanoleaf.PanelPosition) int {
+		return coord(a) - coord(b)
+	})
+	return panels, nil
+}
+
+// panelsInOrder returns the layout's panels with the IDs in order, a
+// comma-separated list such as "11,33,22", in that order. Panels not listed
+// are left out.
+func panelsInOrder(layout *nanoleaf.Layout, order string) ([]nanoleaf.PanelPosition, error) {
+	var panels []nanoleaf.PanelPosition
+	for _, item := range strings.Split(order, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("invalid panel ID %q in order", item)
+		}
+		if slices.ContainsFunc(panels, func(panel nanoleaf.PanelPosition) bool { return panel.PanelID == id }) {
+			return nil, fmt.Errorf("panel %d is listed more than once in order", id)
+		}
+
+		i := slices.IndexFunc(layout.PositionData, func(panel nanoleaf.PanelPosition) bool { return panel.PanelID == id })
+		if i < 0 {
+			ids := make([]int, len(layout.PositionData))
+			for i, panel := range layout.PositionData {
+				ids[i] = panel.PanelID
+			}
+			slices.Sort(ids)
+			return nil, fmt.Errorf("no panel with ID %d (valid IDs: %s)", id, joinInts(ids))
+		}
+		panels = append(panels, layout.PositionData[i])
+	}
+	return panels, nil
+}
+
+// gradientFrames colors panels with a linear RGB gradient from one color to
+// another, according to each panel's relative position along axis, or, if
+// axis is empty, evenly in the order given.
+func gradientFrames(panels []nanoleaf.PanelPosition, axis string, from, to [3]int) []nanoleaf.SetPanelColor {
+	indexes := make(map[int]int, len(panels))
+	for i, panel := range panels {
+		indexes[panel.PanelID] = i
+	}
+	coord := func(panel nanoleaf.PanelPosition) int {
+		switch axis {
+		case "x":
+			return panel.X
+		case "y":
+			return panel.Y
+		default:
+			return indexes[panel.PanelID]
+		}
+	}
+
+	if len(panels) == 0 {
+		return nil
+	}
+	first, last := coord(panels[0]), coord(panels[len(panels)-1])
+
+	frames := make([]nanoleaf.SetPanelColor, len(panels))
+	for i, panel := range panels {
+		t := 0.0
+		if last != first {
+			t = float64(coord(panel)-first) / float64(last-first)
+		}
+
+		frames[i] = nanoleaf.SetPanelColor{
+			PanelID:        uint16(panel.PanelID),
+			Red:            lerp(from[0], to[0], t),
+			Green:          lerp(from[1], to[1], t),
+			Blue:           lerp(from[2], to[2], t),
+			TransitionTime: 1,
+		}
+	}
+	return frames
+}
+
+// rainbowFrames colors panels with evenly spaced hues, in order, starting
+// from the offset hue and transitioning over transition tenths of a second.
+func rainbowFrames(panels []nanoleaf.PanelPosition, offset, sat, brightness int, transition uint16) []nanoleaf.SetPanelColor {
+	frames := make([]nanoleaf.SetPanelColor, len(panels))
+	for i, panel := range panels {
+		hue := (offset + 360*i/len(panels)) % 360
+		red, green, blue := nanoleaf.HSVToRGB(hue, sat, brightness)
+
+		frames[i] = nanoleaf.SetPanelColor{
+			PanelID:        uint16(panel.PanelID),
+			Red:            uint8(red),
+			Green:          uint8(green),
+			Blue:           uint8(blue),
+			TransitionTime: transition,
+		}
+	}
+	return frames
+}
+
+// lerp linearly interpolates between two color channel values.
+func lerp(a, b int, t float64) uint8 {
+	return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+)
+
+// loopUsage documents the flags added by addLoopFlags, for usage messages.
+const loopUsage = "[-loop|-repeat <n>] [-restore]"
+
+// loopFlags holds the flags shared by animated commands that can be rerun
+// until stopped.
+type loopFlags struct {
+	loop    *bool
+	repeat  *int
+	restore *bool
+}
+
+// addLoopFlags adds the -loop, -repeat, and -restore flags to fs.
+func addLoopFlags(fs *flag.FlagSet) *loopFlags {
+	return &loopFlags{
+		loop:    fs.Bool("loop", false, "Rerun the animation until interrupted"),
+		repeat:  fs.Int("repeat", 1, "Number of times to run the animation"),
+		restore: fs.Bool("restore", false, "Restore the prior state when finished or interrupted"),
+	}
+}
+
+// run calls animate once for each repetition, passing the repetition number,
+// until all repetitions have run or the command is interrupted. With
+// -restore, the state from before the first repetition is restored
+// afterwards, even if interrupted.
+func (l *loopFlags) run(ctx context.Context, client *nanoleaf.Client, animate func(ctx context.Context, i int) error) error {
+	if *l.repeat < 1 {
+		return errors.New("repeat must be a positive integer")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	var snapshot *nanoleaf.Snapshot
+	if *l.restore {
+		var err error
+		snapshot, err = client.Snapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+	}
+
+	for i := 0; (*l.loop || i < *l.repeat) && ctx.Err() == nil; i++ {
+		err := animate(ctx, i)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+
+	if snapshot != nil {
+		// Restore even if interrupted part way through.
+		err := client.Restore(context.WithoutCancel(ctx), snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to restore Nanoleaf state: %w", err)
+		}
+	}
+	return nil
+}
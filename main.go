@@ -1,475 +1,3957 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
+	"maps"
 	"math"
+	"math/rand/v2"
+	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/clukawski/microleaf/nanoleaf"
+	"github.com/pelletier/go-toml/v2"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 const defaultConfigFile = ".microleafrc"
 
+// configEnvVar is the environment variable naming an explicit config file.
+const configEnvVar = "MICROLEAF_CONFIG"
+
+// panelEnvVar and verboseEnvVar provide defaults for -n and -v, e.g. for
+// service units and cron entries. The flags take precedence.
+const (
+	panelEnvVar   = "MICROLEAF_PANEL"
+	verboseEnvVar = "MICROLEAF_VERBOSE"
+)
+
+// allPanels is the panel name that selects every configured panel.
+const allPanels = "all"
+
 var configFilePath string
-var panelName string
-var verbose = flag.Bool("v", false, "Verbose")
-var config *MicroleafConfig
+var defaultConfigFilePath string
+var panelNames stringList
+var verbose int
+var colorOutput bool
+var jsonOutput = flag.Bool("json", false, "Output JSON")
+var templateFlag = flag.String("template", "", "Go text/template to format panel info and status output with")
+var outputTemplate *template.Template
+var timeout = flag.Duration("timeout", nanoleaf.DefaultTimeout, "Time allowed for the Nanoleaf to respond")
+var connectTimeout = flag.Duration("connect-timeout", 0, "Time allowed to connect to the Nanoleaf, within -timeout (default no separate limit)")
+var hostFlag = flag.String("host", "", "Nanoleaf host, bypassing the config file (requires -token)")
+var tokenFlag = flag.String("token", "", "Nanoleaf access token, bypassing the config file (requires -host)")
+var noColor = flag.Bool("no-color", false, "Disable colored output (also disabled when stdout isn't a terminal)")
+var noCache = flag.Bool("no-cache", false, "Always fetch the panel name, model, and versions from the Nanoleaf")
+var clampValues = flag.Bool("clamp", false, "Clamp out-of-range values to the valid range instead of failing")
+var dryRun = flag.Bool("dry-run", false, "Print requests that would change the Nanoleaf instead of sending them")
+var retries = flag.Int("retries", 0, "Number of times to retry failed requests")
+var watchInterval = flag.Duration("interval", 2*time.Second, "Polling interval for watch and serve-metrics")
+var strictNames = flag.Bool("strict", false, "Match -n panel and group names exactly, including case")
+var profileFlag = flag.String("profile", "", "Use the named profile's panels from the config file")
+var minInterval = flag.Duration("min-interval", 0, "Minimum time between commands sent to a panel by separate invocations, which wait their turn (default no limit)")
+var discoverTimeout = flag.Duration("discover-timeout", 3*time.Second, "mDNS discovery timeout")
+var config *nanoleaf.MicroleafConfig
 
-// HostConfig defines the structure for individual host configurations.
-type HostConfig struct {
-	PanelName   string `mapstructure:"panel_name,required"`
-	Host        string `mapstructure:"host,required"`
-	AccessToken string `mapstructure:"access_token,required"`
+// stringList is a flag.Value that collects repeated and comma-separated
+// flag values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-// MicroleafConfig defines the overall structure of the configuration file.
-type MicroleafConfig struct {
-	HostConfigs []HostConfig `mapstructure:"host_configs"`
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(*l, v) {
+			*l = append(*l, v)
+		}
+	}
+	return nil
 }
 
-func initConfig() {
+func initFlags() {
 	usr, err := user.Current()
 	if err != nil {
 		log.Fatalf("error: failed to look up current user: %v\n", err)
 		os.Exit(1)
 	}
-	defaultConfigFilePath := usr.HomeDir
+	defaultConfigFilePath = usr.HomeDir
 	flag.StringVar(&configFilePath, "f", defaultConfigFilePath, "Config file path")
-	flag.StringVar(&panelName, "n", "", "Panel name")
+	flag.Var(&panelNames, "n", "Panel or group name (may be repeated or comma-separated)")
+	flag.BoolFunc("v", "Log request summaries (repeat for request and response bodies)", func(string) error {
+		verbose++
+		return nil
+	})
+	flag.BoolFunc("vv", "Log request and response bodies", func(string) error {
+		verbose += 2
+		return nil
+	})
 	flag.Parse()
 
-	// Ensure the user has provided a panel name to search
-	// the config for.
-	if panelName == "" {
-		usage()
+	if len(panelNames) == 0 {
+		panelNames.Set(os.Getenv(panelEnvVar))
+	}
+	if !isFlagSet("v") && !isFlagSet("vv") {
+		if value := os.Getenv(verboseEnvVar); value != "" {
+			verbose = parseVerbose(value)
+		}
 	}
 
-	// Initialize Viper
-	v := viper.New()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: logLevel(verbose),
+	})))
 
-	// Set the config file name without extension
-	v.SetConfigName(defaultConfigFile)
-	// Set the config file type
-	v.SetConfigType("toml")
+	// slog.SetDefault redirects the log package to the slog handler at info
+	// level, which would hide errors and warnings unless -v is given.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
 
-	// Set the path where Viper should look for the config file
-	v.AddConfigPath(configFilePath)
-	v.AddConfigPath(defaultConfigFilePath)
+	// Keep piped output free of escape codes. NO_COLOR is the convention
+	// described at https://no-color.org.
+	colorOutput = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
 
-	// Read the config file
-	if err := v.ReadInConfig(); err != nil {
-		log.Fatalf("error: failed to read in config file: %v\n", err)
+// parseVerbose parses the $MICROLEAF_VERBOSE level, which is a number of -v
+// flags or a boolean, exiting if it is invalid.
+func parseVerbose(value string) int {
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		return n
 	}
-
-	// Unmarshal the config into the MicroleafConfig struct
-	var c MicroleafConfig
-	if err := v.Unmarshal(&c); err != nil {
-		log.Fatalf("error: failed to parse config file: %v\n", err)
+	if b, err := strconv.ParseBool(value); err == nil {
+		if b {
+			return 1
+		}
+		return 0
 	}
-	config = &c
-}
-
-func usage() {
-	fmt.Println("usage: microleaf -n <panel_name> [-f <path>] [-v] <command>")
-	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println()
-	fmt.Println("   on           Turn on Nanoleaf")
-	fmt.Println("   off          Turn off Nanoleaf")
-	fmt.Println()
-	fmt.Println("   effect       Control Nanoleaf effects")
-	fmt.Println("   panel        Control Nanoleaf panel")
-	fmt.Println()
-	fmt.Println("   hsl          Set Nanoleaf to the provided HSL")
-	fmt.Println("   rgb          Set Nanoleaf to the provided RGB")
-	fmt.Println("   temp         Set Nanoleaf to the provided color temperature")
-	fmt.Println("   brightness   Set Nanoleaf to the provided brightness")
-	fmt.Println()
-	fmt.Println("   get          Send a GET request to the Nanoleaf")
-	fmt.Println()
+	fmt.Printf("error: $%s must be a non-negative integer or a boolean, got %q\n", verboseEnvVar, value)
 	os.Exit(1)
+	return 0
 }
 
-func main() {
-	initConfig()
+// logLevel returns the log level for the given number of -v flags.
+func logLevel(verbose int) slog.Level {
+	switch {
+	case verbose >= 2:
+		return slog.LevelDebug
+	case verbose == 1:
+		return slog.LevelInfo
+	default:
+		return slog.LevelWarn
+	}
+}
 
-	if *verbose {
-		fmt.Printf("configs: %+v\n\n", config.HostConfigs)
+func initConfig() {
+	// Ensure the user has provided a panel name to search
+	// the config for.
+	if len(panelNames) == 0 {
+		usage()
 	}
 
-	var client *Client
-	for n, hostConfig := range config.HostConfigs {
-		if hostConfig.PanelName == panelName {
-			client = &Client{
-				Host:    hostConfig.Host,
-				Token:   hostConfig.AccessToken,
-				Verbose: *verbose,
-			}
-			if *verbose {
-				fmt.Printf(
-					"current config [%d]: %s\n\n",
-					n, hostConfig,
-				)
-			}
-			break
+	c, _, err := readConfig()
+	if isConfigNotFound(err) {
+		printConfigHelp()
+		if !bootstrapConfig() {
+			os.Exit(1)
 		}
+		c, _, err = readConfig()
 	}
-	if client == nil {
-		log.Println("error: no config matching specified panel name")
-		usage()
+	if err != nil {
+		log.Fatalf("error: %v\n", err)
 	}
 
-	if flag.NArg() > 0 {
-		cmd := flag.Arg(0)
-		switch cmd {
-		case "brightness":
-			doBrightnessCommand(client, flag.Args()[1:])
-		case "effect":
-			doEffectCommand(client, flag.Args()[1:])
-		case "get":
-			doGetCommand(client, flag.Args()[1:])
-		case "hsl":
-			doHSLCommand(client, flag.Args()[1:])
-		case "off":
-			err := client.Off()
-			if err != nil {
-				fmt.Println("error: failed to turn off Nanoleaf:", err)
-				os.Exit(1)
-			}
-		case "on":
-			err := client.On()
-			if err != nil {
-				fmt.Println("error: failed to turn on Nanoleaf:", err)
-				os.Exit(1)
-			}
-		case "panel":
-			doPanelCommand(client, flag.Args()[1:])
-		case "rgb":
-			doRGBCommand(client, flag.Args()[1:])
-		case "temp":
-			doColorTemperatureCommand(client, flag.Args()[1:])
-		default:
-			usage()
+	c, err = selectProfile(c)
+	if err != nil {
+		log.Fatalf("error: %v\n", err)
+	}
+
+	if err := validateConfig(c); err != nil {
+		if *profileFlag != "" {
+			log.Fatalf("error: invalid config file (profile %q):\n%v\n", *profileFlag, err)
 		}
-	} else {
-		usage()
+		log.Fatalf("error: invalid config file:\n%v\n", err)
 	}
+	config = c
 }
 
-func doBrightnessCommand(client *Client, args []string) {
-	if len(args) < 1 {
-		fmt.Println("usage: microleaf brightness <brightness>")
-		os.Exit(1)
+// selectProfile returns the config of the profile named by -profile, or c
+// itself if no profile was requested. The top-level host configs and groups
+// act as the default profile.
+func selectProfile(c *nanoleaf.MicroleafConfig) (*nanoleaf.MicroleafConfig, error) {
+	if *profileFlag == "" {
+		return c, nil
 	}
 
-	brightness, err := strconv.Atoi(args[0])
-	if err != nil || brightness < 0 || brightness > 100 {
-		fmt.Println("error: temperature must be an integer 0-100")
-		os.Exit(1)
+	profile, ok := c.Profiles[*profileFlag]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return nil, fmt.Errorf("no profile named %q: the config file has no profiles", *profileFlag)
+		}
+		names := slices.Sorted(maps.Keys(c.Profiles))
+		return nil, fmt.Errorf("no profile named %q (profiles: %s)", *profileFlag, strings.Join(names, ", "))
 	}
+	return &nanoleaf.MicroleafConfig{HostConfigs: profile.HostConfigs, Groups: profile.Groups, Scenes: c.Scenes}, nil
+}
 
-	err = client.SetBrightness(brightness)
-	if err != nil {
-		fmt.Println("error: failed to set brightness:", err)
-		os.Exit(1)
+// isConfigNotFound reports whether err means there is no config file yet.
+func isConfigNotFound(err error) bool {
+	return errors.As(err, &viper.ConfigFileNotFoundError{}) || errors.Is(err, fs.ErrNotExist)
+}
+
+// printConfigHelp explains where the config file is looked for, and how to
+// create one.
+func printConfigHelp() {
+	fmt.Println("error: no config file found. microleaf looked for:")
+	fmt.Println()
+	switch file := configFile(); {
+	case file != "":
+		fmt.Printf("   %s\n", file)
+	case isFlagSet("f"):
+		fmt.Printf("   %s\n", filepath.Join(configFilePath, defaultConfigFile))
+		fmt.Printf("   %s\n", filepath.Join(defaultConfigFilePath, defaultConfigFile))
+	default:
+		fmt.Println("   $XDG_CONFIG_HOME/microleaf/config.toml")
+		fmt.Printf("   %s\n", filepath.Join(defaultConfigFilePath, defaultConfigFile))
+		fmt.Println()
+		fmt.Printf("A config file elsewhere can be given with -f or $%s.\n", configEnvVar)
 	}
+	fmt.Println()
+	fmt.Println("To create one, hold the Nanoleaf's power button for 5-7 seconds until its")
+	fmt.Println("LED flashes, then within 30 seconds run:")
+	fmt.Println()
+	fmt.Println("   microleaf -n <panel_name> pair <host>")
+	fmt.Println()
+	fmt.Println("Run `microleaf discover` to find the hosts of Nanoleaf devices on your network.")
 }
 
-func doColorTemperatureCommand(client *Client, args []string) {
-	if len(args) < 1 {
-		fmt.Println("usage: microleaf temp <temperature>")
-		os.Exit(1)
+// bootstrapConfig offers to discover a Nanoleaf and pair with it under the
+// selected panel name, creating the config file. It reports whether a config
+// was created.
+func bootstrapConfig() bool {
+	// Only offer when someone is there to answer, and there's a single
+	// name to save the panel under.
+	if !isTerminal(os.Stdin) || len(panelNames) != 1 || panelNames[0] == allPanels {
+		return false
 	}
 
-	temp, err := strconv.Atoi(args[0])
-	if err != nil || temp < 1200 || temp > 6500 {
-		fmt.Println("error: temperature must be an integer 1200-6500")
-		os.Exit(1)
+	fmt.Println()
+	if !confirm("Search the local network for Nanoleaf devices now?") {
+		return false
 	}
 
-	err = client.SetColorTemperature(temp)
+	panels, err := nanoleaf.Discover(*discoverTimeout)
 	if err != nil {
-		fmt.Println("error: failed to set color temperature:", err)
-		os.Exit(1)
+		fmt.Println("error: failed to discover Nanoleaf devices:", err)
+		return false
+	}
+	if len(panels) == 0 {
+		fmt.Println("No Nanoleaf devices found.")
+		return false
 	}
-}
 
-func doEffectCommand(client *Client, args []string) {
-	usage := func() {
-		fmt.Println("usage: microleaf effect list")
-		fmt.Println("       microleaf effect select <name>")
-		fmt.Println("       microleaf effect custom [<panel> <red> <green> <blue> <transition time>] ...")
-		os.Exit(1)
+	for i, panel := range panels {
+		fmt.Printf("%2d. %-24s %-21s %s\n", i+1, panel.Name, panel.Host, panel.Model)
 	}
 
-	if len(args) < 1 {
-		usage()
+	promptMu.Lock()
+	fmt.Printf("Pair which device as %q? [1-%d, or empty to skip] ", panelNames[0], len(panels))
+	answer, _ := stdin.ReadString('\n')
+	promptMu.Unlock()
+
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(panels) {
+		return false
 	}
 
-	command := args[0]
-	switch command {
-	case "custom":
-		customArgs := args[1:]
-		numFrameArgs := 5
-		if len(customArgs)%numFrameArgs != 0 {
-			fmt.Println("usage: microleaf effect custom [<panel> <red> <green> <blue> <transition time>] ...")
+	fmt.Println("Hold the Nanoleaf's power button for 5-7 seconds until its LED flashes.")
+	if !confirm("Is it flashing?") {
+		return false
+	}
+	doPairCommand([]string{panels[choice-1].Host})
+	return true
+}
+
+// validateConfig checks that every host config has the fields it requires,
+// since viper doesn't enforce the `required` mapstructure tags, that no
+// panel name is used more than once, that groups only contain configured
+// panels, and that scenes only run known commands.
+func validateConfig(c *nanoleaf.MicroleafConfig) error {
+	var errs []error
+	seen := make(map[string]int)
+	for i, hostConfig := range c.HostConfigs {
+		if hostConfig.PanelName == "" {
+			errs = append(errs, fmt.Errorf("host_configs[%d]: missing panel_name", i))
+		} else if j, ok := seen[hostConfig.PanelName]; ok {
+			errs = append(errs, fmt.Errorf("host_configs[%d]: duplicate panel_name %q (also used by host_configs[%d])", i, hostConfig.PanelName, j))
+		} else {
+			seen[hostConfig.PanelName] = i
 		}
 
-		numFrames := len(customArgs) / numFrameArgs
-		frames := make([]SetPanelColor, numFrames)
-		for i := 0; i < numFrames; i++ {
-			offset := numFrameArgs * i
-			panelID, err := strconv.ParseUint(customArgs[offset], 10, 16)
-			if err != nil {
-				fmt.Printf("error: expected panel ID between 0-%d, got %s", math.MaxUint16, customArgs[offset])
-				os.Exit(1)
-			}
+		// An empty host is allowed, and is looked up via mDNS discovery.
 
-			red, err := strconv.ParseUint(customArgs[offset+1], 10, 8)
-			if err != nil {
-				fmt.Printf("error: expected red value between 0-%d, got %s", math.MaxUint8, customArgs[offset+1])
-				os.Exit(1)
-			}
+		if hostConfig.AccessToken == "" {
+			errs = append(errs, fmt.Errorf("host_configs[%d]: missing access_token", i))
+		}
 
-			green, err := strconv.ParseUint(customArgs[offset+2], 10, 8)
-			if err != nil {
-				fmt.Printf("error: expected green value between 0-%d, got %s", math.MaxUint8, customArgs[offset+2])
-				os.Exit(1)
+		if hostConfig.Timeout != "" {
+			if _, err := time.ParseDuration(hostConfig.Timeout); err != nil {
+				errs = append(errs, fmt.Errorf("host_configs[%d]: invalid timeout %q", i, hostConfig.Timeout))
 			}
+		}
 
-			blue, err := strconv.ParseUint(customArgs[offset+3], 10, 8)
-			if err != nil {
-				fmt.Printf("error: expected blue value between 0-%d, got %s", math.MaxUint8, customArgs[offset+3])
-				os.Exit(1)
+		if hostConfig.MinInterval != "" {
+			if d, err := time.ParseDuration(hostConfig.MinInterval); err != nil || d < 0 {
+				errs = append(errs, fmt.Errorf("host_configs[%d]: invalid min_interval %q", i, hostConfig.MinInterval))
 			}
+		}
 
-			transitionTime, err := strconv.ParseUint(customArgs[offset+4], 10, 16)
-			if err != nil {
-				fmt.Printf("error: expected transition time between 0-%d, got %s", math.MaxUint16, customArgs[offset+4])
-				os.Exit(1)
+		if hostConfig.DefaultCommand != "" {
+			if _, err := splitArgs(hostConfig.DefaultCommand); err != nil {
+				errs = append(errs, fmt.Errorf("host_configs[%d]: invalid default_command: %v", i, err))
 			}
-
-			frames[i].PanelID = uint16(panelID)
-			frames[i].Red = uint8(red)
-			frames[i].Green = uint8(green)
-			frames[i].Blue = uint8(blue)
-			frames[i].TransitionTime = uint16(transitionTime)
 		}
+	}
 
-		err := client.SetCustomColors(frames)
-		if err != nil {
-			fmt.Println("error: failed to start external control:", err)
-			os.Exit(1)
+	for _, group := range slices.Sorted(maps.Keys(c.Groups)) {
+		if _, ok := seen[group]; ok {
+			errs = append(errs, fmt.Errorf("groups.%s: group name is already used by a panel", group))
+		} else if group == allPanels {
+			errs = append(errs, fmt.Errorf("groups.%s: group name is reserved", group))
 		}
-	case "list":
-		list, err := client.ListEffects()
-		if err != nil {
-			fmt.Println("error: failed retrieve effects list:", err)
-			os.Exit(1)
+		for _, name := range c.Groups[group] {
+			if _, ok := seen[name]; !ok {
+				errs = append(errs, fmt.Errorf("groups.%s: no config matching panel name %q", group, name))
+			}
 		}
-		for _, name := range list {
-			fmt.Println(name)
+	}
+
+	for _, scene := range slices.Sorted(maps.Keys(c.Scenes)) {
+		if len(c.Scenes[scene]) == 0 {
+			errs = append(errs, fmt.Errorf("scenes.%s: scene has no commands", scene))
 		}
-	case "select":
-		if len(args) != 2 {
-			fmt.Println("usage: microleaf effect select <name>")
-			os.Exit(1)
+		for i, step := range c.Scenes[scene] {
+			stepArgs, err := splitArgs(step)
+			if err == nil && len(stepArgs) == 0 {
+				err = errors.New("empty command")
+			}
+			if err == nil {
+				err = checkSceneCommand(stepArgs[0])
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("scenes.%s[%d]: %v", scene, i, err))
+			}
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		name := args[1]
-		err := client.SelectEffect(name)
-		if err != nil {
-			fmt.Println("error: failed to select effect:", err)
-			os.Exit(1)
+// resolveName returns the panel or group name matching name, ignoring case,
+// if name isn't itself a panel or group name. If several names differ from
+// name only in case, it is ambiguous.
+func resolveName(name string, panelNames, groupNames []string) (string, error) {
+	if name == allPanels || slices.Contains(panelNames, name) || slices.Contains(groupNames, name) {
+		return name, nil
+	}
+
+	var matches []string
+	for _, candidate := range slices.Concat(panelNames, groupNames, []string{allPanels}) {
+		if strings.EqualFold(candidate, name) && !slices.Contains(matches, candidate) {
+			matches = append(matches, candidate)
 		}
+	}
+	switch len(matches) {
+	case 0:
+		return name, nil
+	case 1:
+		return matches[0], nil
 	default:
-		usage()
+		return "", fmt.Errorf("panel or group name %q is ambiguous: matches %s (use the exact name)", name, strings.Join(matches, ", "))
 	}
 }
 
-func doGetCommand(client *Client, args []string) {
-	if len(args) < 1 {
-		fmt.Println("usage: microleaf get <path>")
-		os.Exit(1)
-	}
+// selectHostConfigs returns the host configs matching the requested panel
+// names. The name "all" selects every host config, unless a host config is
+// literally named "all", and a group name selects every panel in the group.
+// Unless -strict is given, names that don't match exactly may differ in case.
+func selectHostConfigs(c *nanoleaf.MicroleafConfig, names []string) ([]nanoleaf.HostConfig, error) {
+	hostConfigs := c.HostConfigs
+	var selected []nanoleaf.HostConfig
+	for _, name := range names {
+		panelNames := make([]string, len(hostConfigs))
+		for i, hostConfig := range hostConfigs {
+			panelNames[i] = hostConfig.PanelName
+		}
+		groupNames := slices.Sorted(maps.Keys(c.Groups))
 
-	res, err := client.Get(args[0])
-	if err != nil {
-		fmt.Println("error: failed to set color temperature:", err)
-		os.Exit(1)
+		if !*strictNames {
+			var err error
+			name, err = resolveName(name, panelNames, groupNames)
+			if err != nil {
+				return nil, err
+			}
+		}
+		members, isGroup := c.Groups[name]
+
+		i := slices.Index(panelNames, name)
+
+		switch {
+		case i >= 0:
+			if name == allPanels {
+				log.Printf("warning: panel named %q shadows the %q panel selector\n", name, allPanels)
+			}
+			selected = append(selected, hostConfigs[i])
+		case name == allPanels:
+			selected = append(selected, hostConfigs...)
+		case isGroup:
+			for _, hostConfig := range hostConfigs {
+				if slices.Contains(members, hostConfig.PanelName) {
+					selected = append(selected, hostConfig)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("no config matching panel or group name %q", name)
+		}
 	}
 
-	fmt.Println(res)
+	// Drop panels selected more than once, e.g. by "all" and by name.
+	var deduped []nanoleaf.HostConfig
+	for _, hostConfig := range selected {
+		if !slices.Contains(deduped, hostConfig) {
+			deduped = append(deduped, hostConfig)
+		}
+	}
+	return deduped, nil
 }
 
-func doPanelCommand(client *Client, args []string) {
-	usage := func() {
-		fmt.Println("usage: microleaf panel info")
-		fmt.Println("       microleaf panel model")
-		fmt.Println("       microleaf panel name")
-		fmt.Println("       microleaf panel version")
-		os.Exit(1)
+// readConfig reads the config file, returning the parsed config and the
+// path of the file it was read from.
+func readConfig() (*nanoleaf.MicroleafConfig, string, error) {
+	// Initialize Viper
+	v := viper.New()
+
+	if file := configFile(); file != "" {
+		v.SetConfigType(configType(file))
+		v.SetConfigFile(file)
+	} else {
+		// .microleafrc has no extension, so the type must be set
+		v.SetConfigType("toml")
+
+		// Set the config file name without extension
+		v.SetConfigName(defaultConfigFile)
+
+		// Set the path where Viper should look for the config file
+		v.AddConfigPath(configFilePath)
+		v.AddConfigPath(defaultConfigFilePath)
 	}
 
-	if len(args) != 1 {
-		usage()
+	// Read the config file
+	if err := v.ReadInConfig(); err != nil {
+		var parseErr viper.ConfigParseError
+		if errors.As(err, &parseErr) {
+			return nil, "", configDecodeError(v.ConfigFileUsed(), err)
+		}
+		return nil, "", fmt.Errorf("failed to read in config file: %w", err)
+	}
+
+	// Unmarshal the config into the MicroleafConfig struct
+	var c nanoleaf.MicroleafConfig
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, "", configDecodeError(v.ConfigFileUsed(), fmt.Errorf("failed to parse config file: %w", err))
 	}
+	return &c, v.ConfigFileUsed(), nil
+}
 
-	panelInfo, err := client.GetPanelInfo()
+// configDecodeError decodes the config file at path with its format's own
+// decoder, which, unlike viper, reports where in the file an error is. If
+// that finds no error, or the file can't be read again, viperErr is
+// returned unchanged.
+func configDecodeError(path string, viperErr error) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("error: failed to get Nanoleaf state:", err)
-		os.Exit(1)
+		return viperErr
 	}
 
-	command := args[0]
-	switch command {
-	case "info":
-		fmt.Println("Name:", panelInfo.Name)
-		fmt.Println()
-		fmt.Println("Manufacturer:", panelInfo.Manufacturer)
-		fmt.Println("Model:       ", panelInfo.Model)
-		fmt.Println("Serial No:   ", panelInfo.SerialNo)
-		fmt.Println()
-		fmt.Println("Firmware Version:", panelInfo.FirmwareVersion)
-		fmt.Println()
-		fmt.Println("State:")
-		fmt.Println("  On:  ", panelInfo.State.On.Value)
-		fmt.Println("  Mode:", panelInfo.State.ColorMode)
-		fmt.Println()
-		fmt.Printf("  Hue:        %3d° [%d°-%d°]\n", panelInfo.State.Hue.Value, *panelInfo.State.Hue.Min, *panelInfo.State.Hue.Max)
-		fmt.Printf("  Saturation: %3d  [%d-%d]\n", panelInfo.State.Saturation.Value, *panelInfo.State.Saturation.Min, *panelInfo.State.Saturation.Max)
-		fmt.Printf("  Brightness: %3d  [%d-%d]\n", panelInfo.State.Brightness.Value, *panelInfo.State.Brightness.Min, *panelInfo.State.Brightness.Max)
-		fmt.Println()
-		fmt.Printf("  Color Temperature: %4dK [%dK-%dK]\n", panelInfo.State.ColorTemperature.Value, *panelInfo.State.ColorTemperature.Min, *panelInfo.State.ColorTemperature.Max)
-		fmt.Println()
-		fmt.Println("Effects:")
-		fmt.Println("  Selected:", panelInfo.Effects.Selected)
-		fmt.Println("  Available:")
-		for _, effect := range panelInfo.Effects.List {
-			fmt.Println("  -", effect)
-		}
-		fmt.Println()
-		fmt.Println("Layout:")
-		fmt.Printf("  Orientation: %d° [%d°-%d°]\n", panelInfo.PanelLayout.GlobalOrientation.Value, panelInfo.PanelLayout.GlobalOrientation.Min, panelInfo.PanelLayout.GlobalOrientation.Max)
-		fmt.Println("  Panels:     ", panelInfo.PanelLayout.Layout.NumPanels)
-		fmt.Println("  Side Length:", panelInfo.PanelLayout.Layout.SideLength)
-		fmt.Println()
-		fmt.Println("  Panel Positions:")
-		for _, panel := range panelInfo.PanelLayout.Layout.PositionData {
-			fmt.Printf("  - %3d: (%d, %d, %d°)\n", panel.PanelID, panel.X, panel.Y, panel.O)
-		}
-		fmt.Println()
-		fmt.Println("Rhythm:")
-		fmt.Println("  ID:      ", panelInfo.Rhythm.ID)
-		fmt.Printf("  Position: (%.0f, %.0f, %.0f°)\n", panelInfo.Rhythm.Position.X, panelInfo.Rhythm.Position.Y, panelInfo.Rhythm.Position.O)
-		fmt.Println()
-		fmt.Println("  Connected:    ", panelInfo.Rhythm.Connected)
-		fmt.Println("  Aux Available:", panelInfo.Rhythm.AuxAvailable)
-		fmt.Println("  Active:       ", panelInfo.Rhythm.Active)
-		fmt.Println("  Mode:         ", panelInfo.Rhythm.Mode)
-		fmt.Println()
-		fmt.Println("  Versions:")
-		fmt.Println("    Hardware:", panelInfo.Rhythm.HardwareVersion)
-		fmt.Println("    Firmware:", panelInfo.Rhythm.FirmwareVersion)
-		fmt.Println()
-	case "layout":
-		fmt.Printf("Orientation: %d° [%d°-%d°]\n", panelInfo.PanelLayout.GlobalOrientation.Value, panelInfo.PanelLayout.GlobalOrientation.Min, panelInfo.PanelLayout.GlobalOrientation.Max)
-		fmt.Println("Panels:     ", panelInfo.PanelLayout.Layout.NumPanels)
-		fmt.Println("Side Length:", panelInfo.PanelLayout.Layout.SideLength)
-		fmt.Println()
-		fmt.Println("Positions:")
-		for _, panel := range panelInfo.PanelLayout.Layout.PositionData {
-			fmt.Printf("- %3d: (%d, %d, %d°)\n", panel.PanelID, panel.X, panel.Y, panel.O)
+	var c nanoleaf.MicroleafConfig
+	var location string
+	switch configType(path) {
+	case "yaml":
+		// yaml.v3 errors already include the line number.
+		err = yaml.Unmarshal(data, &c)
+	case "json":
+		err = json.Unmarshal(data, &c)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		// JSON error offsets count the bytes read, so the last byte read is
+		// the one at fault.
+		if errors.As(err, &syntaxErr) {
+			location = lineColumn(data, syntaxErr.Offset-1)
+		} else if errors.As(err, &typeErr) {
+			location = lineColumn(data, typeErr.Offset-1)
+			err = fmt.Errorf("%s: cannot use JSON %s as %s", typeErr.Field, typeErr.Value, typeErr.Type)
 		}
-		fmt.Println()
-	case "model":
-		fmt.Println(panelInfo.Model)
-	case "name":
-		fmt.Println(panelInfo.Name)
-	case "state":
-		fmt.Println("On:  ", panelInfo.State.On.Value)
-		fmt.Println("Mode:", panelInfo.State.ColorMode)
-		fmt.Println()
-		fmt.Printf("Brightness: %3d [%d-%d]\n", panelInfo.State.Brightness.Value, *panelInfo.State.Brightness.Min, *panelInfo.State.Brightness.Max)
-		fmt.Printf("Hue:        %3d [%d-%d]\n", panelInfo.State.Hue.Value, *panelInfo.State.Hue.Min, *panelInfo.State.Hue.Max)
-		fmt.Printf("Saturation: %3d [%d-%d]\n", panelInfo.State.Saturation.Value, *panelInfo.State.Saturation.Min, *panelInfo.State.Saturation.Max)
-		fmt.Println()
-		fmt.Printf("Color Temperature: %4dK [%dK-%dK]\n", panelInfo.State.ColorTemperature.Value, *panelInfo.State.ColorTemperature.Min, *panelInfo.State.ColorTemperature.Max)
-		fmt.Println()
-	case "version":
-		fmt.Println("Panel Firmware:", panelInfo.FirmwareVersion)
-		fmt.Println()
-		fmt.Println("Rhythm:")
-		fmt.Println("  Hardware:", panelInfo.Rhythm.HardwareVersion)
-		fmt.Println("  Firmware:", panelInfo.Rhythm.FirmwareVersion)
-		fmt.Println()
 	default:
-		usage()
+		err = toml.Unmarshal(data, &c)
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			row, column := decodeErr.Position()
+			location = fmt.Sprintf("line %d, column %d", row, column)
+			if key := decodeErr.Key(); len(key) > 0 {
+				location += ", key " + strings.Join(key, ".")
+			}
+			err = fmt.Errorf("%v\n%s", err, decodeErr.String())
+		}
+	}
+	if err == nil {
+		return viperErr
 	}
-}
 
-func doHSLCommand(client *Client, args []string) {
-	if len(args) != 3 {
-		fmt.Println("usage: microleaf hsl <hue> <saturation> <lightness>")
-		os.Exit(1)
+	if location != "" {
+		return fmt.Errorf("failed to parse config file %s at %s: %w", path, location, err)
 	}
+	return fmt.Errorf("failed to parse config file %s: %w", path, err)
+}
 
-	hue, err := strconv.Atoi(args[0])
-	if err != nil || hue < 0 || hue > 360 {
-		fmt.Println("error: hue must be an integer 0-100")
-		os.Exit(1)
+// lineColumn returns the 1-based line and column of the byte at offset in
+// data, formatted for an error message.
+func lineColumn(data []byte, offset int64) string {
+	offset = max(0, min(offset, int64(len(data))))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d", line, column)
+}
+
+// configFile returns the path of an explicitly located config file, or an
+// empty string if the config file should be searched for in the -f and home
+// directories. An explicit -f takes precedence over $MICROLEAF_CONFIG, which
+// takes precedence over $XDG_CONFIG_HOME/microleaf/config.toml.
+func configFile() string {
+	if isFlagSet("f") {
+		// -f may name the config file itself, rather than its
+		// directory. A file that doesn't exist yet (e.g. for pair) is
+		// recognized by its extension.
+		info, err := os.Stat(configFilePath)
+		isFile := err == nil && !info.IsDir()
+		isNewFile := errors.Is(err, fs.ErrNotExist) &&
+			slices.Contains(configExtensions, strings.ToLower(filepath.Ext(configFilePath)))
+		if isFile || isNewFile {
+			return configFilePath
+		}
+		return ""
 	}
 
-	sat, err := strconv.Atoi(args[1])
-	if err != nil || sat < 0 || sat > 100 {
-		fmt.Println("error: saturation must be an integer 0-360")
-		os.Exit(1)
+	if file := os.Getenv(configEnvVar); file != "" {
+		return file
 	}
 
-	lightness, err := strconv.Atoi(args[2])
-	if err != nil || lightness < 0 || lightness > 100 {
-		fmt.Println("error: lightness must be an integer 0-100")
-		os.Exit(1)
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(defaultConfigFilePath, ".config")
 	}
+	file := filepath.Join(configHome, "microleaf", "config.toml")
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+	return ""
+}
 
-	err = client.SetHSL(hue, sat, lightness)
-	if err != nil {
-		fmt.Println("error: failed to set HSL:", err)
-		os.Exit(1)
+// configExtensions lists the config file extensions that select a format
+// other than the default TOML, along with .toml itself.
+var configExtensions = []string{".toml", ".yaml", ".yml", ".json"}
+
+// configType returns the viper config type for the config file at path,
+// based on its extension. Files without a recognized extension, such as
+// .microleafrc, are TOML.
+func configType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	default:
+		return "toml"
 	}
 }
 
-func doRGBCommand(client *Client, args []string) {
-	if len(args) != 3 {
-		fmt.Println("usage: microleaf rgb <red> <green> <blue>")
-		os.Exit(1)
+// isFlagSet reports whether the named flag was set on the command line.
+func isFlagSet(name string) bool {
+	return isFlagSetIn(flag.CommandLine, name)
+}
+
+// isFlagSetIn reports whether the named flag was set in fs.
+func isFlagSetIn(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// writeConfig writes cfg to the config file at path, in the format given by
+// its extension. The config is written to a temporary file that is renamed
+// over path, so a failed write never leaves a truncated config behind.
+func writeConfig(path string, cfg *nanoleaf.MicroleafConfig) error {
+	var data []byte
+	var err error
+	switch configType(path) {
+	case "yaml":
+		data, err = yaml.Marshal(cfg)
+	case "json":
+		data, err = json.MarshalIndent(cfg, "", "  ")
+		data = append(data, '\n')
+	default:
+		data, err = toml.Marshal(cfg)
+	}
+	if err != nil {
+		return err
 	}
 
-	red, err := strconv.Atoi(args[0])
-	if err != nil || red < 0 || red > 255 {
-		fmt.Println("error: red must be an integer 0-255")
-		os.Exit(1)
+	// The temporary file must be in the same directory for the rename to
+	// be atomic. It is created with mode 0600, keeping tokens private.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(f.Name())
 
-	green, err := strconv.Atoi(args[1])
-	if err != nil || green < 0 || green > 255 {
-		fmt.Println("error: green must be an integer 0-255")
-		os.Exit(1)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
 	}
+	return os.Rename(f.Name(), path)
+}
 
-	blue, err := strconv.Atoi(args[2])
-	if err != nil || blue < 0 || blue > 255 {
-		fmt.Println("error: blue must be an integer 0-255")
-		os.Exit(1)
+// printSynopsis prints the short forms of the microleaf command line.
+func printSynopsis() {
+	fmt.Println("usage: microleaf -n <panel_name>[,<panel_name>...]|all [-f <path>] [-profile <name>] [-strict] [-timeout <duration>] [-connect-timeout <duration>] [-min-interval <duration>] [-retries <n>] [-clamp] [-dry-run] [-v|-vv] [-json] [-template <template>] [-no-color] [-no-cache] <command>")
+	fmt.Println("       microleaf -host <host> -token <token> [-timeout <duration>] [-connect-timeout <duration>] [-min-interval <duration>] [-retries <n>] [-clamp] [-dry-run] [-v|-vv] [-json] [-template <template>] [-no-color] [-no-cache] <command>")
+	fmt.Println("       microleaf [-discover-timeout <duration>] [-json] discover")
+}
+
+// unknownCommand reports an unrecognized command, suggesting the closest
+// known command for likely typos, and exits.
+func unknownCommand(cmd string) {
+	fmt.Printf("error: unknown command %q\n", cmd)
+	if suggestion := suggestCommand(cmd); suggestion != "" {
+		fmt.Printf("did you mean %q?\n", suggestion)
 	}
+	fmt.Println()
+	printSynopsis()
+	fmt.Println()
+	fmt.Println("Run microleaf without arguments to list the commands.")
+	os.Exit(1)
+}
 
-	err = client.SetRGB(red, green, blue)
+// unknownCommandError returns an error for an unrecognized command in a
+// script or scene, suggesting the closest known command.
+func unknownCommandError(cmd string) error {
+	if suggestion := suggestCommand(cmd); suggestion != "" {
+		return fmt.Errorf("unknown command %q (did you mean %q?)", cmd, suggestion)
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// suggestCommand returns the known command closest to cmd by edit distance,
+// or an empty string if none is close enough to be a likely typo.
+func suggestCommand(cmd string) string {
+	if cmd == "" {
+		return ""
+	}
+	best, bestDistance := "", max(2, len(cmd)/3)+1
+	for _, known := range commands {
+		if d := levenshtein(cmd, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the number of single character insertions, deletions,
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func usage() {
+	printSynopsis()
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println()
+	fmt.Println("   on           Turn on Nanoleaf")
+	fmt.Println("   off          Turn off Nanoleaf")
+	fmt.Println("   toggle       Toggle Nanoleaf on or off")
+	fmt.Println()
+	fmt.Println("   effect       Control Nanoleaf effects")
+	fmt.Println("   panel        Control Nanoleaf panel")
+	fmt.Println("   identify     Flash the Nanoleaf's panels")
+	fmt.Println("   flash        Blink the Nanoleaf, then restore its state")
+	fmt.Println("   pulse        Smoothly ramp the Nanoleaf's brightness down and up")
+	fmt.Println()
+	fmt.Println("   hsl          Set Nanoleaf to the provided HSL")
+	fmt.Println("   hsv          Set Nanoleaf to the provided HSV")
+	fmt.Println("   rgb          Set Nanoleaf to the provided RGB, hex, or named color")
+	fmt.Println("   hue          Set or adjust only the Nanoleaf's hue")
+	fmt.Println("   sat          Set or adjust only the Nanoleaf's saturation")
+	fmt.Println("   temp         Set Nanoleaf to the provided color temperature")
+	fmt.Println("   fade         Gradually change the Nanoleaf from one color to another")
+	fmt.Println("   gradient     Spread a two-color gradient across the panels")
+	fmt.Println("   rainbow      Spread a rainbow across the panels")
+	fmt.Println("   wipe         Sweep a color across the panels one by one")
+	fmt.Println("   sunrise      Gradually brighten and cool the Nanoleaf")
+	fmt.Println("   sunset       Gradually dim and warm the Nanoleaf")
+	fmt.Println("   brightness   Set Nanoleaf to the provided brightness")
+	fmt.Println()
+	fmt.Println("   save         Save the Nanoleaf's current state to a file")
+	fmt.Println("   restore      Restore the Nanoleaf's state from a file")
+	fmt.Println("   run          Run a script of commands from a file")
+	fmt.Println("   scene        Run a scene of commands defined in the config")
+	fmt.Println()
+	fmt.Println("   status       Print a one-line summary of the Nanoleaf's state")
+	fmt.Println("   ping         Check that the Nanoleaf is reachable")
+	fmt.Println("   watch        Print Nanoleaf state changes as they happen")
+	fmt.Println("   touch        Print taps and swipes on the Nanoleaf's panels")
+	fmt.Println("   serve-metrics  Serve Prometheus metrics for the Nanoleaf")
+	fmt.Println()
+	fmt.Println("   get          Send a GET request to the Nanoleaf")
+	fmt.Println("   put          Send a PUT request to the Nanoleaf")
+	fmt.Println("   post         Send a POST request to the Nanoleaf")
+	fmt.Println("   delete       Send a DELETE request to the Nanoleaf")
+	fmt.Println()
+	fmt.Println("   discover     Find Nanoleaf devices on the local network")
+	fmt.Println("   pair         Obtain an access token and save it to the config")
+	fmt.Println("   completion   Print a shell completion script")
+	fmt.Println("   version      Print the microleaf version")
+	fmt.Println()
+	fmt.Println("Template fields (for -template with panel info and status):")
+	fmt.Println()
+	fmt.Println("   .Name .Model .SerialNo .Manufacturer .FirmwareVersion")
+	fmt.Println("   .State.On.Value .State.Brightness.Value .State.ColorTemperature.Value")
+	fmt.Println("   .State.Hue.Value .State.Saturation.Value .State.ColorMode")
+	fmt.Println("   .Effects.Selected .Effects.List")
+	fmt.Println("   .PanelLayout.Layout.NumPanels .PanelLayout.GlobalOrientation.Value")
+	fmt.Println("   .Rhythm.Connected .Rhythm.Active .Rhythm.FirmwareVersion")
+	fmt.Println()
+	os.Exit(1)
+}
+
+func main() {
+	initFlags()
+
+	// Catch typos before loading the config or contacting any panels.
+	if cmd := flag.Arg(0); cmd != "" && !slices.Contains(commands, cmd) {
+		unknownCommand(cmd)
+	}
+
+	// The version describes the binary, not a panel.
+	if flag.Arg(0) == "version" {
+		doVersionCommand(flag.Args()[1:])
+		return
+	}
+
+	// Discovery doesn't need a config file, so handle it before
+	// loading one.
+	if flag.Arg(0) == "discover" {
+		doDiscoverCommand(flag.Args()[1:])
+		return
+	}
+
+	// Completion scripts are static, apart from listing configured panel
+	// names, which shouldn't require selecting one.
+	if flag.Arg(0) == "completion" {
+		doCompletionCommand(flag.Args()[1:])
+		return
+	}
+
+	// Pairing creates or updates the panel's config entry, so it
+	// can't require one to exist yet.
+	if flag.Arg(0) == "pair" {
+		doPairCommand(flag.Args()[1:])
+		return
+	}
+
+	var hostConfigs []nanoleaf.HostConfig
+	switch {
+	case *hostFlag != "" && *tokenFlag != "":
+		// Skip the config file entirely. -n, if given, only names
+		// the panel.
+		name := *hostFlag
+		if len(panelNames) == 1 {
+			name = panelNames[0]
+		}
+		hostConfigs = []nanoleaf.HostConfig{{
+			PanelName:   name,
+			Host:        *hostFlag,
+			AccessToken: *tokenFlag,
+		}}
+	case *hostFlag != "" || *tokenFlag != "":
+		fmt.Println("error: -host and -token must be used together")
+		os.Exit(1)
+	default:
+		initConfig()
+
+		slog.Debug("loaded config", "host_configs", config.HostConfigs)
+
+		var err error
+		hostConfigs, err = selectHostConfigs(config, panelNames)
+		if err != nil {
+			log.Println("error:", err)
+			usage()
+		}
+	}
+
+	var clients []*nanoleaf.Client
+	var names []string
+	var intervals []time.Duration
+	var commandLines [][]string
+	for n, hostConfig := range hostConfigs {
+		// Fall back to mDNS discovery if the panel has no host
+		// configured.
+		if hostConfig.Host == "" {
+			host, err := nanoleaf.DiscoverHost(hostConfig.PanelName, *discoverTimeout)
+			if err != nil {
+				log.Fatalf("error: failed to discover host for %s: %v\n", hostConfig.PanelName, err)
+			}
+			hostConfig.Host = host
+		}
+
+		// An explicit -timeout takes precedence over the config.
+		clientTimeout := *timeout
+		if hostConfig.Timeout != "" && !isFlagSet("timeout") {
+			clientTimeout, _ = time.ParseDuration(hostConfig.Timeout)
+		}
+
+		clients = append(clients, &nanoleaf.Client{
+			Host:    hostConfig.Host,
+			Token:   hostConfig.AccessToken,
+			Logger:  slog.With("panel", hostConfig.PanelName),
+			Timeout: clientTimeout,
+			Retries: *retries,
+			DryRun:  *dryRun,
+			Output:  os.Stdout,
+
+			ConnectTimeout: *connectTimeout,
+
+			ValidateTemperature: true,
+			ValidateBrightness:  true,
+		})
+		names = append(names, hostConfig.PanelName)
+		slog.Debug("selected config", "index", n, "config", hostConfig)
+
+		// An explicit -min-interval also takes precedence over the
+		// config.
+		interval := *minInterval
+		if hostConfig.MinInterval != "" && !isFlagSet("min-interval") {
+			interval, _ = time.ParseDuration(hostConfig.MinInterval)
+		}
+		intervals = append(intervals, interval)
+
+		// Without a command, run the panel's default command, if it
+		// has one. It was checked when the config was validated.
+		commandLine := flag.Args()
+		if len(commandLine) == 0 {
+			commandLine, _ = splitArgs(hostConfig.DefaultCommand)
+			if len(commandLine) == 0 {
+				usage()
+			}
+		}
+		commandLines = append(commandLines, commandLine)
+	}
+
+	if *templateFlag != "" {
+		var err error
+		outputTemplate, err = template.New("output").Parse(*templateFlag)
+		if err != nil {
+			fmt.Println("error: invalid template:", err)
+			os.Exit(1)
+		}
+	}
+	ctx := context.Background()
+
+	// Metrics for every panel are served from a single HTTP server, so
+	// this can't run per panel.
+	if flag.Arg(0) == "serve-metrics" {
+		err := doServeMetricsCommand(ctx, clients, names, flag.Args()[1:])
+		if err != nil {
+			printUsage(os.Stdout, err)
+			if !isBareUsage(err) {
+				fmt.Println("error:", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(clients) == 1 {
+		err := runHostCommand(ctx, os.Stdout, clients[0], intervals[0], commandLines[0])
+		if err != nil {
+			if !isBareUsage(err) {
+				fmt.Println("error:", err)
+				printErrorHint(err, names[0])
+			}
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// Run the command against every panel concurrently, labeling each
+	// line of output with the panel it came from.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := newPrefixWriter(os.Stdout, &mu, names[i]+": ")
+			// Label dry-run requests with the panel too.
+			client.Output = w
+			errs[i] = runHostCommand(ctx, w, client, intervals[i], commandLines[i])
+			w.Flush()
+		}()
+	}
+	wg.Wait()
+
+	code := 0
+	for i, err := range errs {
+		if err != nil {
+			if !isBareUsage(err) {
+				fmt.Printf("error: %s: %v\n", names[i], err)
+				printErrorHint(err, names[i])
+			}
+			code = max(code, exitCode(err))
+		}
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// printErrorHint prints a suggestion for fixing err, if there is one, for the
+// named panel.
+func printErrorHint(err error, name string) {
+	if !errors.Is(err, nanoleaf.ErrUnauthorized) {
+		return
+	}
+	pair := fmt.Sprintf("microleaf -n %s pair", name)
+	if *hostFlag != "" {
+		pair = fmt.Sprintf("microleaf -n <panel_name> pair %s", *hostFlag)
+	}
+	fmt.Printf("hint: the access token for %s is invalid or was revoked (e.g. by a factory reset); run `%s` to get a new one\n", name, pair)
+}
+
+// Exit codes distinguishing why ping failed. Other failures exit with 1.
+const (
+	exitUnreachable  = 2
+	exitUnauthorized = 3
+)
+
+// exitError is an error that should exit with a specific status code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// usageError is an error in a command's arguments. The command's usage is
+// printed before the error is reported, through the command's writer so that
+// it's labeled in multi-panel output. Like other errors that aren't
+// exitErrors, it exits with status 1.
+type usageError struct {
+	err   error
+	usage []string
+}
+
+func (e *usageError) Error() string {
+	if e.err == nil {
+		return "invalid arguments"
+	}
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error { return e.err }
+
+// errUsage returns a usageError with the given lines of usage. err, if not
+// nil, says what was wrong with the arguments.
+func errUsage(err error, usage ...string) error {
+	// Asking for help isn't an error worth reporting beyond the usage.
+	if errors.Is(err, flag.ErrHelp) {
+		err = nil
+	}
+	return &usageError{err: err, usage: usage}
+}
+
+// parseFlags parses a command's flags from args. fs must continue on error,
+// so that the caller can return the error with the command's usage rather
+// than exiting, which would stop the command running against other panels.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	return fs.Parse(args)
+}
+
+// printUsage prints the usage of a usageError in err, if there is one, to w.
+func printUsage(w io.Writer, err error) {
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		for _, line := range usageErr.usage {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// isBareUsage reports whether err is only a usageError without a message,
+// which was reported in full by printing the usage.
+func isBareUsage(err error) bool {
+	usageErr, ok := err.(*usageError)
+	return ok && usageErr.err == nil
+}
+
+// exitCode returns the status code to exit with after err.
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return 1
+}
+
+// runHostCommand runs commandLine against client, first waiting for the
+// minimum interval since the last command sent to its host, if there is one.
+func runHostCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, interval time.Duration, commandLine []string) error {
+	// Dry runs don't send anything, so can't collide.
+	if interval > 0 && !client.DryRun {
+		err := waitForHost(ctx, client.Host, interval)
+		if err != nil {
+			return err
+		}
+	}
+	err := runCommand(ctx, w, client, commandLine[0], commandLine[1:])
+	// Script lines and scene steps print their own usage errors as they
+	// happen, so only print the usage of the command itself.
+	if _, ok := err.(*usageError); ok {
+		printUsage(w, err)
+	}
+	return err
+}
+
+// runCommand runs the named command against client, writing output to w.
+func runCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, cmd string, args []string) error {
+	switch cmd {
+	case "brightness":
+		return doBrightnessCommand(ctx, w, client, args)
+	case "delete":
+		return doDeleteCommand(ctx, w, client, args)
+	case "effect":
+		return doEffectCommand(ctx, w, client, args)
+	case "fade":
+		return doFadeCommand(ctx, w, client, args)
+	case "flash":
+		return doFlashCommand(ctx, w, client, args)
+	case "get":
+		return doGetCommand(ctx, w, client, args)
+	case "gradient":
+		return doGradientCommand(ctx, w, client, args)
+	case "hsl":
+		return doHSLCommand(ctx, w, client, args)
+	case "hsv":
+		return doHSVCommand(ctx, w, client, args)
+	case "hue":
+		return doHueCommand(ctx, w, client, args)
+	case "identify":
+		err := client.Identify(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to identify Nanoleaf: %w", err)
+		}
+	case "off":
+		err := client.Off(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to turn off Nanoleaf: %w", err)
+		}
+	case "on":
+		return doOnCommand(ctx, w, client, args)
+	case "panel":
+		return doPanelCommand(ctx, w, client, args)
+	case "ping":
+		return doPingCommand(ctx, w, client, args)
+	case "post":
+		return doPostCommand(ctx, w, client, args)
+	case "pulse":
+		return doPulseCommand(ctx, w, client, args)
+	case "put":
+		return doPutCommand(ctx, w, client, args)
+	case "rainbow":
+		return doRainbowCommand(ctx, w, client, args)
+	case "restore":
+		return doRestoreCommand(ctx, w, client, args)
+	case "rgb":
+		return doRGBCommand(ctx, w, client, args)
+	case "run":
+		return doRunCommand(ctx, w, client, args)
+	case "sat":
+		return doSaturationCommand(ctx, w, client, args)
+	case "save":
+		return doSaveCommand(ctx, w, client, args)
+	case "scene":
+		return doSceneCommand(ctx, w, client, args)
+	case "status":
+		return doStatusCommand(ctx, w, client, args)
+	case "sunrise", "sunset":
+		return doSunCommand(ctx, w, client, cmd, args)
+	case "temp":
+		return doColorTemperatureCommand(ctx, w, client, args)
+	case "touch":
+		return doTouchCommand(ctx, w, client, args)
+	case "watch":
+		return doWatchCommand(ctx, w, client, args)
+	case "wipe":
+		return doWipeCommand(ctx, w, client, args)
+	case "toggle":
+		err := client.Toggle(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to toggle Nanoleaf: %w", err)
+		}
+	default:
+		return unknownCommandError(cmd)
+	}
+	return nil
+}
+
+func doBrightnessCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) < 1 {
+		return errUsage(nil,
+			"usage: microleaf brightness <brightness> [<duration>]",
+			"       microleaf brightness <+|-><increment>",
+			"       microleaf brightness fade <brightness> <duration>",
+		)
+	}
+
+	if args[0] == "fade" {
+		if len(args) != 3 {
+			return errUsage(nil, "usage: microleaf brightness fade <brightness> <duration>")
+		}
+
+		brightness, err := parseIntInRange(args[1], "brightness", 0, 100, brightnessRange(ctx, client))
+		if err != nil {
+			return err
+		}
+
+		duration, err := parseDuration(args[2])
+		if err != nil {
+			return err
+		}
+		if duration < 1 {
+			return errors.New("duration must be at least 1 second")
+		}
+
+		err = client.SetBrightness(ctx, brightness, duration)
+		if err != nil {
+			return fmt.Errorf("failed to fade brightness: %w", err)
+		}
+		return nil
+	}
+
+	if isIncrement(args[0]) {
+		delta, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New("brightness increment must be an integer")
+		}
+
+		// The Nanoleaf keeps the result within its 0-100 bounds, so
+		// there's no point in sending a larger step than the full range.
+		delta = max(-100, min(delta, 100))
+
+		err = client.AdjustBrightness(ctx, delta)
+		if err != nil {
+			return fmt.Errorf("failed to adjust brightness: %w", err)
+		}
+		return nil
+	}
+
+	brightness, err := parseIntInRange(args[0], "brightness", 0, 100, brightnessRange(ctx, client))
+	if err != nil {
+		return err
+	}
+
+	duration := 0
+	if len(args) > 1 {
+		duration, err = parseDuration(args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.SetBrightness(ctx, brightness, duration)
+	if err != nil {
+		return fmt.Errorf("failed to set brightness: %w", err)
+	}
+	return nil
+}
+
+func doHueCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	return doStateValueCommand(ctx, client, "hue", 0, 360, hueBounds, client.SetHue, client.AdjustHue, args)
+}
+
+func doSaturationCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	return doStateValueCommand(ctx, client, "sat", 0, 100, saturationBounds, client.SetSaturation, client.AdjustSaturation, args)
+}
+
+// doStateValueCommand sets a single state value, optionally transitioning
+// over a duration, or adjusts it by an increment prefixed with + or -.
+func doStateValueCommand(
+	ctx context.Context,
+	client *nanoleaf.Client,
+	name string,
+	lo, hi int,
+	bounds func(*nanoleaf.State) (lo, hi *int),
+	set func(ctx context.Context, value int, duration int) error,
+	adjust func(ctx context.Context, delta int) error,
+	args []string,
+) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage(nil,
+			fmt.Sprintf("usage: microleaf %s <%s> [<duration>]", name, name),
+			fmt.Sprintf("       microleaf %s <+|-><increment>", name),
+		)
+	}
+
+	if isIncrement(args[0]) {
+		delta, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("%s increment must be an integer", name)
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("%s increments can't take a duration", name)
+		}
+
+		// As with brightness, the Nanoleaf keeps the result within
+		// its bounds.
+		delta = max(lo-hi, min(delta, hi-lo))
+
+		err = adjust(ctx, delta)
+		if err != nil {
+			return fmt.Errorf("failed to adjust %s: %w", name, err)
+		}
+		return nil
+	}
+
+	value, err := parseIntInRange(args[0], name, lo, hi, stateRange(ctx, client, bounds))
+	if err != nil {
+		return err
+	}
+
+	duration := 0
+	if len(args) > 1 {
+		duration, err = parseDuration(args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = set(ctx, value, duration)
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
+
+// sunriseStart and sunriseEnd are the light levels a sunrise ramps between.
+// A sunset ramps between them in reverse.
+var (
+	sunriseStart = nanoleaf.LightLevel{Brightness: 1, ColorTemperature: temperaturePresets["warm"]}
+	sunriseEnd   = nanoleaf.LightLevel{Brightness: 100, ColorTemperature: temperaturePresets["cool"]}
+)
+
+func doSunCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, cmd string, args []string) error {
+	if len(args) != 1 {
+		return errUsage(nil, fmt.Sprintf("usage: microleaf %s <duration>", cmd))
+	}
+
+	duration, err := time.ParseDuration(args[0])
+	if err != nil || duration <= 0 {
+		return errors.New("duration must be a positive duration (e.g. 15m)")
+	}
+
+	from, to := sunriseStart, sunriseEnd
+	if cmd == "sunset" {
+		from, to = to, from
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	err = client.Ramp(ctx, from, to, duration)
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", cmd, err)
+	}
+	return nil
+}
+
+// fadeStep is the time between the colors sent by `fade`.
+const fadeStep = 200 * time.Millisecond
+
+func doFadeCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 3 {
+		return errUsage(nil, "usage: microleaf fade <from color> <to color> <duration>")
+	}
+
+	var from, to [3]int
+	for i, color := range []*[3]int{&from, &to} {
+		red, green, blue, err := parseColor(args[i])
+		if err != nil {
+			return err
+		}
+		*color = [3]int{red, green, blue}
+	}
+
+	duration, err := time.ParseDuration(args[2])
+	if err != nil || duration <= 0 {
+		return errors.New("duration must be a positive duration (e.g. 10s)")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// Step the color ourselves rather than relying on the Nanoleaf's
+	// transition duration, which some firmware ignores. If interrupted,
+	// the Nanoleaf is left at the last color sent.
+	steps := max(1, int(duration/fadeStep))
+	ticker := time.NewTicker(duration / time.Duration(steps))
+	defer ticker.Stop()
+
+	last := [3]int{-1, -1, -1}
+	for i := 0; i <= steps; i++ {
+		red, green, blue := nanoleaf.MixRGB(from[0], from[1], from[2], to[0], to[1], to[2], float64(i)/float64(steps))
+		if color := [3]int{red, green, blue}; color != last {
+			err := client.SetRGB(ctx, red, green, blue, 0)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to set RGB: %w", err)
+			}
+			last = color
+		}
+
+		if i < steps {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+	return nil
+}
+
+func doColorTemperatureCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) < 1 {
+		return errUsage(nil,
+			"usage: microleaf temp <temperature>|warm|neutral|cool|daylight [<duration>]",
+			"       microleaf temp <+|-><increment>",
+		)
+	}
+
+	if isIncrement(args[0]) {
+		delta, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New("temperature increment must be an integer")
+		}
+		if len(args) > 1 {
+			return errors.New("temperature increments can't take a duration")
+		}
+
+		// The Nanoleaf keeps the result within its range, so there's
+		// no point in sending a larger step than the whole range.
+		lo, hi, err := client.ColorTemperatureRange(ctx)
+		if err != nil {
+			lo, hi = 1200, 6500
+		}
+		delta = max(lo-hi, min(delta, hi-lo))
+
+		err = client.AdjustColorTemperature(ctx, delta)
+		if err != nil {
+			return fmt.Errorf("failed to adjust color temperature: %w", err)
+		}
+		return nil
+	}
+
+	temp, ok := temperaturePresets[strings.ToLower(args[0])]
+	if !ok {
+		_, err := strconv.Atoi(strings.TrimPrefix(args[0], "="))
+		if err != nil {
+			return errors.New("temperature must be an integer 1200-6500 or one of warm, neutral, cool, daylight")
+		}
+		temp, err = parseIntInRange(args[0], "temperature", 1200, 6500, temperatureRange(ctx, client))
+		if err != nil {
+			return err
+		}
+	}
+
+	duration := 0
+	if len(args) > 1 {
+		var err error
+		duration, err = parseDuration(args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	err := client.SetColorTemperature(ctx, temp, duration)
+	if err != nil {
+		return fmt.Errorf("failed to set color temperature: %w", err)
+	}
+	return nil
+}
+
+func doCompletionCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: microleaf completion bash|fish|zsh")
+		os.Exit(1)
+	}
+
+	// Completion scripts call back into `completion panels` to list the
+	// configured panel names.
+	if args[0] == "panels" {
+		c, _, err := readConfig()
+		if err == nil {
+			c, err = selectProfile(c)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		for _, hostConfig := range c.HostConfigs {
+			fmt.Println(hostConfig.PanelName)
+		}
+		for _, group := range slices.Sorted(maps.Keys(c.Groups)) {
+			fmt.Println(group)
+		}
+		return
+	}
+
+	err := writeCompletion(os.Stdout, args[0])
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+}
+
+func doDeleteCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage(nil, "usage: microleaf delete <path>")
+	}
+
+	res, err := client.Delete(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to send DELETE request: %w", err)
+	}
+
+	fmt.Fprintln(w, res)
+	return nil
+}
+
+func doDiscoverCommand(args []string) {
+	if len(args) != 0 {
+		fmt.Println("usage: microleaf [-discover-timeout <duration>] discover")
+		os.Exit(1)
+	}
+
+	panels, err := nanoleaf.Discover(*discoverTimeout)
+	if err != nil {
+		fmt.Println("error: failed to discover Nanoleaf devices:", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		err := printJSON(os.Stdout, panels)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	for _, panel := range panels {
+		fmt.Printf("%-24s %-21s %s\n", panel.Name, panel.Host, panel.Model)
+	}
+
+	err = saveDiscoveredHosts(panels)
+	if err != nil {
+		fmt.Println("error: failed to write config file:", err)
+		os.Exit(1)
+	}
+}
+
+// saveDiscoveredHosts offers to update the host of each configured panel
+// whose discovered host differs from the config. Panels that aren't
+// configured yet need an access token, so they're added with pair instead.
+func saveDiscoveredHosts(panels []nanoleaf.DiscoveredPanel) error {
+	// Only offer when someone is there to answer.
+	if !isTerminal(os.Stdin) {
+		return nil
+	}
+
+	cfg, path, err := readConfig()
+	if err != nil {
+		// Without a readable config there's nothing to update.
+		return nil
+	}
+
+	changed := false
+	for _, panel := range panels {
+		i := slices.IndexFunc(cfg.HostConfigs, func(hostConfig nanoleaf.HostConfig) bool {
+			return hostConfig.PanelName == panel.Name
+		})
+		if i < 0 || cfg.HostConfigs[i].Host == panel.Host {
+			continue
+		}
+
+		hostConfig := &cfg.HostConfigs[i]
+		prompt := fmt.Sprintf("Save host %s for %s?", panel.Host, panel.Name)
+		if hostConfig.Host != "" {
+			prompt = fmt.Sprintf("Update host for %s from %s to %s?", panel.Name, hostConfig.Host, panel.Host)
+		}
+		if confirm(prompt) {
+			hostConfig.Host = panel.Host
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return writeConfig(path, cfg)
+}
+
+func doEffectCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	usage := func(err error) error {
+		return errUsage(err,
+			"usage: microleaf effect [-o text|json|yaml] list [-sort] [-filter <substring>] [-long]",
+			"       microleaf effect [-o text|json|yaml] current",
+			"       microleaf effect next|prev",
+			"       microleaf effect random [-exclude]",
+			"       microleaf effect create [-plugin flow|wheel] [-trans <tenths>] [-delay <tenths>] [-direction left|right|up|down] <name> <color> <color> ...",
+			"       microleaf effect delete [-y] <name>",
+			"       microleaf effect export <name> <file>",
+			"       microleaf effect import <file>",
+			"       microleaf effect loop <name> on|off",
+			"       microleaf effect select <name>",
+			"       microleaf effect [-o text|json|yaml] show <name>",
+			"       microleaf effect custom [-no-validate] [-unit ds|ms|s] [<panel> <red> <green> <blue> <transition time>] ...",
+			"       microleaf effect custom [-no-validate] [-unit ds|ms|s] -panels <list> <color> [<transition time>]",
+			"       microleaf effect custom [-no-validate] -file <frames.json>",
+		)
+	}
+
+	fs := flag.NewFlagSet("effect", flag.ContinueOnError)
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+	format, err := outputFormat(*output)
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	if len(args) < 1 {
+		return usage(nil)
+	}
+
+	command := args[0]
+	switch command {
+	case "custom":
+		fs := flag.NewFlagSet("effect custom", flag.ContinueOnError)
+		noValidate := fs.Bool("no-validate", false, "Don't check panel IDs against the layout")
+		file := fs.String("file", "", "Read frames from a JSON file instead of the arguments")
+		panelList := fs.String("panels", "", "Set the listed panels and ranges of panels (e.g. 1-5,8,10) to one color")
+		unit := fs.String("unit", "ds", "Unit of the transition times: ds (tenths of a second), ms, or s")
+		usage := func(err error) error {
+			return errUsage(err,
+				"usage: microleaf effect custom [-no-validate] [-unit ds|ms|s] [<panel> <red> <green> <blue> <transition time>] ...",
+				"       microleaf effect custom [-no-validate] [-unit ds|ms|s] -panels <list> <color> [<transition time>]",
+				"       microleaf effect custom [-no-validate] -file <frames.json>",
+				"",
+				"Transition times are in tenths of a second (the Nanoleaf's unit), unless",
+				"-unit is given. Frames read with -file are always in tenths of a second.",
+			)
+		}
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return usage(err)
+		}
+
+		if _, ok := transitionUnits[*unit]; !ok || (*file != "" && isFlagSetIn(fs, "unit")) {
+			return usage(nil)
+		}
+
+		customArgs := fs.Args()
+		if *panelList != "" {
+			if *file != "" || len(customArgs) < 1 || len(customArgs) > 2 {
+				return usage(nil)
+			}
+			frames, err := panelListFrames(ctx, client, *panelList, customArgs, *unit, *noValidate)
+			if err != nil {
+				return err
+			}
+			err = client.SetCustomColors(ctx, frames)
+			if err != nil {
+				return fmt.Errorf("failed to start external control: %w", err)
+			}
+			return nil
+		}
+
+		numFrameArgs := 5
+		if len(customArgs)%numFrameArgs != 0 || (*file != "" && len(customArgs) != 0) {
+			return usage(nil)
+		}
+
+		numFrames := len(customArgs) / numFrameArgs
+		frames := make([]nanoleaf.SetPanelColor, numFrames)
+		if *file != "" {
+			var err error
+			frames, err = readCustomFrames(*file)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < numFrames; i++ {
+			offset := numFrameArgs * i
+			panelID, err := strconv.ParseUint(customArgs[offset], 10, 16)
+			if err != nil {
+				return fmt.Errorf("expected panel ID between 0-%d, got %s", math.MaxUint16, customArgs[offset])
+			}
+
+			red, err := strconv.ParseUint(customArgs[offset+1], 10, 8)
+			if err != nil {
+				return fmt.Errorf("expected red value between 0-%d, got %s", math.MaxUint8, customArgs[offset+1])
+			}
+
+			green, err := strconv.ParseUint(customArgs[offset+2], 10, 8)
+			if err != nil {
+				return fmt.Errorf("expected green value between 0-%d, got %s", math.MaxUint8, customArgs[offset+2])
+			}
+
+			blue, err := strconv.ParseUint(customArgs[offset+3], 10, 8)
+			if err != nil {
+				return fmt.Errorf("expected blue value between 0-%d, got %s", math.MaxUint8, customArgs[offset+3])
+			}
+
+			transitionTime, err := parseTransitionTime(customArgs[offset+4], *unit)
+			if err != nil {
+				return err
+			}
+
+			frames[i].PanelID = uint16(panelID)
+			frames[i].Red = uint8(red)
+			frames[i].Green = uint8(green)
+			frames[i].Blue = uint8(blue)
+			frames[i].TransitionTime = transitionTime
+		}
+
+		if !*noValidate {
+			err := validatePanelIDs(ctx, client, frames)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := client.SetCustomColors(ctx, frames)
+		if err != nil {
+			return fmt.Errorf("failed to start external control: %w", err)
+		}
+	case "create":
+		return doEffectCreateCommand(ctx, w, client, args[1:])
+	case "delete":
+		fs := flag.NewFlagSet("effect delete", flag.ContinueOnError)
+		yes := fs.Bool("y", false, "Delete without asking for confirmation")
+		usage := func(err error) error {
+			return errUsage(err, "usage: microleaf effect delete [-y] <name>")
+		}
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return usage(err)
+		}
+		if fs.NArg() != 1 {
+			return usage(nil)
+		}
+
+		name := fs.Arg(0)
+		list, err := client.ListEffects(ctx)
+		if err != nil {
+			return fmt.Errorf("failed retrieve effects list: %w", err)
+		}
+		if !slices.Contains(list, name) {
+			return fmt.Errorf("no effect named %q", name)
+		}
+
+		if !*yes && !confirm(fmt.Sprintf("Delete effect %q from %s?", name, client.Host)) {
+			return nil
+		}
+
+		err = client.DeleteEffect(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to delete effect: %w", err)
+		}
+	case "export":
+		if len(args) != 3 {
+			return errUsage(nil, "usage: microleaf effect export <name> <file>")
+		}
+
+		effect, err := client.ExportEffect(ctx, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to export effect: %w", err)
+		}
+
+		var data bytes.Buffer
+		err = json.Indent(&data, effect, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode effect: %w", err)
+		}
+		data.WriteByte('\n')
+
+		err = os.WriteFile(args[2], data.Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write effect: %w", err)
+		}
+	case "import":
+		if len(args) != 2 {
+			return errUsage(nil, "usage: microleaf effect import <file>")
+		}
+
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read effect: %w", err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("failed to parse effect: %s is not valid JSON", args[1])
+		}
+
+		err = client.ImportEffect(ctx, data)
+		if err != nil {
+			return fmt.Errorf("failed to import effect: %w", err)
+		}
+	case "loop":
+		if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+			return errUsage(nil, "usage: microleaf effect loop <name> on|off")
+		}
+
+		err := client.SetEffectLoop(ctx, args[1], args[2] == "on")
+		if errors.Is(err, nanoleaf.ErrLoopUnsupported) {
+			return fmt.Errorf("effect %q has no loop setting (only custom and static effects can be set to play once)", args[1])
+		} else if err != nil {
+			return fmt.Errorf("failed to set effect loop: %w", err)
+		}
+	case "list":
+		fs := flag.NewFlagSet("effect list", flag.ContinueOnError)
+		sortList := fs.Bool("sort", false, "Sort effects alphabetically")
+		filter := fs.String("filter", "", "Only list effects containing the substring (case-insensitive)")
+		long := fs.Bool("long", false, "Also show each effect's type and palette")
+		usage := func(err error) error {
+			return errUsage(err, "usage: microleaf effect list [-sort] [-filter <substring>] [-long]")
+		}
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return usage(err)
+		}
+		if fs.NArg() != 0 {
+			return usage(nil)
+		}
+
+		if *long {
+			return listEffectsLong(ctx, w, client, format, *filter, *sortList)
+		}
+
+		list, err := client.ListEffects(ctx)
+		if err != nil {
+			return fmt.Errorf("failed retrieve effects list: %w", err)
+		}
+		if *filter != "" {
+			substr := strings.ToLower(*filter)
+			list = slices.DeleteFunc(list, func(name string) bool {
+				return !strings.Contains(strings.ToLower(name), substr)
+			})
+		}
+		if *sortList {
+			slices.Sort(list)
+		}
+		if format != "text" {
+			return render(w, format, list)
+		}
+		for _, name := range list {
+			fmt.Fprintln(w, name)
+		}
+	case "current":
+		if len(args) != 1 {
+			return errUsage(nil, "usage: microleaf effect [-o text|json|yaml] current")
+		}
+
+		name, err := client.GetSelectedEffect(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get selected effect: %w", err)
+		}
+		if format != "text" {
+			return render(w, format, name)
+		}
+		fmt.Fprintln(w, name)
+	case "next", "prev":
+		if len(args) != 1 {
+			return usage(nil)
+		}
+
+		effects, err := getEffects(ctx, client)
+		if err != nil {
+			return err
+		}
+		if len(effects.List) == 0 {
+			return errors.New("no effects installed")
+		}
+
+		step := 1
+		if command == "prev" {
+			step = -1
+		}
+		name := adjacentEffect(*effects, step)
+		err = client.SelectEffect(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to select effect: %w", err)
+		}
+		fmt.Fprintln(w, name)
+	case "random":
+		fs := flag.NewFlagSet("effect random", flag.ContinueOnError)
+		exclude := fs.Bool("exclude", false, "Never pick the currently selected effect")
+		usage := func(err error) error {
+			return errUsage(err, "usage: microleaf effect random [-exclude]")
+		}
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return usage(err)
+		}
+		if fs.NArg() != 0 {
+			return usage(nil)
+		}
+
+		var list []string
+		if *exclude {
+			effects, err := getEffects(ctx, client)
+			if err != nil {
+				return err
+			}
+			list = slices.DeleteFunc(effects.List, func(name string) bool {
+				return name == effects.Selected
+			})
+		} else {
+			var err error
+			list, err = client.ListEffects(ctx)
+			if err != nil {
+				return fmt.Errorf("failed retrieve effects list: %w", err)
+			}
+		}
+		if len(list) == 0 {
+			return errors.New("no effects to choose from")
+		}
+
+		name := list[rand.IntN(len(list))]
+		err := client.SelectEffect(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to select effect: %w", err)
+		}
+		fmt.Fprintln(w, name)
+	case "show":
+		if len(args) != 2 {
+			return errUsage(nil, "usage: microleaf effect show <name>")
+		}
+
+		effectInfo, err := client.GetEffectInfo(ctx, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to get effect: %w", err)
+		}
+		if format != "text" {
+			return render(w, format, effectInfo)
+		}
+
+		fmt.Fprintln(w, "Name:", effectInfo.Name)
+		fmt.Fprintln(w, "Type:", effectInfo.Type)
+		if effectInfo.PluginType != "" {
+			fmt.Fprintln(w, "Plugin Type:", effectInfo.PluginType)
+		}
+		if effectInfo.ColorType != "" {
+			fmt.Fprintln(w, "Color Type:", effectInfo.ColorType)
+		}
+		if len(effectInfo.Palette) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Palette:")
+			for _, color := range effectInfo.Palette {
+				fmt.Fprintf(w, "  Hue: %3d°  Saturation: %3d  Brightness: %3d\n", color.Hue, color.Saturation, color.Brightness)
+			}
+		}
+		if len(effectInfo.PluginOptions) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Options:")
+			for _, option := range effectInfo.PluginOptions {
+				fmt.Fprintf(w, "  %s: %v\n", option.Name, option.Value)
+			}
+		}
+	case "select":
+		if len(args) != 2 {
+			return errUsage(nil, "usage: microleaf effect select <name>")
+		}
+
+		name := args[1]
+		err := client.SelectEffect(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to select effect: %w", err)
+		}
+	default:
+		return usage(nil)
+	}
+	return nil
+}
+
+// customFrame is an entry in an `effect custom -file` frames file. Fields
+// are pointers so that missing fields can be reported.
+type customFrame struct {
+	PanelID        *int `json:"panelId"`
+	Red            *int `json:"red"`
+	Green          *int `json:"green"`
+	Blue           *int `json:"blue"`
+	TransitionTime *int `json:"transitionTime"`
+}
+
+// readCustomFrames reads a JSON array of custom frames from the file at path,
+// returning an error identifying the first malformed entry.
+func readCustomFrames(path string) ([]nanoleaf.SetPanelColor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("%s: expected a JSON array of frames", path)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	frames := make([]nanoleaf.SetPanelColor, len(entries))
+	for i, entry := range entries {
+		var frame customFrame
+		dec := json.NewDecoder(bytes.NewReader(entry))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&frame); err != nil {
+			return nil, fmt.Errorf("%s: frame %d: %w", path, i, err)
+		}
+
+		fields := []struct {
+			name  string
+			value *int
+			max   int
+		}{
+			{"panelId", frame.PanelID, math.MaxUint16},
+			{"red", frame.Red, math.MaxUint8},
+			{"green", frame.Green, math.MaxUint8},
+			{"blue", frame.Blue, math.MaxUint8},
+			{"transitionTime", frame.TransitionTime, math.MaxUint16},
+		}
+		for _, field := range fields {
+			if field.value == nil {
+				return nil, fmt.Errorf("%s: frame %d: missing %s", path, i, field.name)
+			}
+			if *field.value < 0 || *field.value > field.max {
+				return nil, fmt.Errorf("%s: frame %d: expected %s between 0-%d, got %d", path, i, field.name, field.max, *field.value)
+			}
+		}
+
+		frames[i] = nanoleaf.SetPanelColor{
+			PanelID:        uint16(*frame.PanelID),
+			Red:            uint8(*frame.Red),
+			Green:          uint8(*frame.Green),
+			Blue:           uint8(*frame.Blue),
+			TransitionTime: uint16(*frame.TransitionTime),
+		}
+	}
+	return frames, nil
+}
+
+// panelListFrames builds frames setting every panel in list, a
+// comma-separated list of panel IDs and inclusive ID ranges such as
+// "1-5,8,10", to the color in args[0], transitioning over the optional
+// args[1] (in unit, or a tenth of a second by default). Ranges select the
+// panels in the layout whose IDs fall within them, unless noValidate is set.
+func panelListFrames(ctx context.Context, client *nanoleaf.Client, list string, args []string, unit string, noValidate bool) ([]nanoleaf.SetPanelColor, error) {
+	red, green, blue, err := parseColor(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	transitionTime := uint16(1)
+	if len(args) > 1 {
+		transitionTime, err = parseTransitionTime(args[1], unit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var layoutIDs []int
+	if !noValidate {
+		layout, err := client.GetLayout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get panel layout: %w", err)
+		}
+		for _, panel := range layout.PositionData {
+			layoutIDs = append(layoutIDs, panel.PanelID)
+		}
+		slices.Sort(layoutIDs)
+	}
+
+	var ids []int
+	for _, item := range strings.Split(list, ",") {
+		lo, hi, err := parsePanelRange(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case noValidate:
+			for id := lo; id <= hi; id++ {
+				ids = append(ids, id)
+			}
+		case lo == hi:
+			if !slices.Contains(layoutIDs, lo) {
+				return nil, fmt.Errorf("no panel with ID %d (valid IDs: %s)", lo, joinInts(layoutIDs))
+			}
+			ids = append(ids, lo)
+		default:
+			matched := false
+			for _, id := range layoutIDs {
+				if id >= lo && id <= hi {
+					ids = append(ids, id)
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("no panels with IDs in %d-%d (valid IDs: %s)", lo, hi, joinInts(layoutIDs))
+			}
+		}
+	}
+
+	var frames []nanoleaf.SetPanelColor
+	for _, id := range ids {
+		if slices.ContainsFunc(frames, func(frame nanoleaf.SetPanelColor) bool { return int(frame.PanelID) == id }) {
+			continue
+		}
+		frames = append(frames, nanoleaf.SetPanelColor{
+			PanelID:        uint16(id),
+			Red:            uint8(red),
+			Green:          uint8(green),
+			Blue:           uint8(blue),
+			TransitionTime: transitionTime,
+		})
+	}
+	return frames, nil
+}
+
+// transitionUnits maps the units accepted by `effect custom -unit` to their
+// length in tenths of a second, the unit used by the Nanoleaf.
+var transitionUnits = map[string]float64{
+	"ds": 1,
+	"ms": 0.01,
+	"s":  10,
+}
+
+// parseTransitionTime parses a transition time in unit, returning it in
+// tenths of a second, rounded to the nearest.
+func parseTransitionTime(s, unit string) (uint16, error) {
+	scale := transitionUnits[unit]
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 || math.Round(value*scale) > math.MaxUint16 {
+		maxValue := strconv.FormatFloat(math.MaxUint16/scale, 'f', -1, 64)
+		return 0, fmt.Errorf("expected transition time between 0-%s%s, got %s", maxValue, unit, s)
+	}
+	return uint16(math.Round(value * scale)), nil
+}
+
+// parsePanelRange parses a panel ID, or an inclusive range of IDs such as
+// "1-5", returning its bounds.
+func parsePanelRange(s string) (lo, hi int, err error) {
+	first, last, isRange := strings.Cut(s, "-")
+	lo, err = strconv.Atoi(first)
+	if err == nil {
+		hi = lo
+		if isRange {
+			hi, err = strconv.Atoi(last)
+		}
+	}
+	if err != nil || lo < 0 || hi > math.MaxUint16 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid panel ID or range %q: expected e.g. 8 or 1-5, with IDs between 0-%d", s, math.MaxUint16)
+	}
+	return lo, hi, nil
+}
+
+// validatePanelIDs returns an error listing the valid panel IDs if any frame
+// addresses a panel that isn't in the Nanoleaf's layout.
+func validatePanelIDs(ctx context.Context, client *nanoleaf.Client, frames []nanoleaf.SetPanelColor) error {
+	layout, err := client.GetLayout(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get panel layout: %w", err)
+	}
+
+	var valid []int
+	for _, panel := range layout.PositionData {
+		valid = append(valid, panel.PanelID)
+	}
+	for _, frame := range frames {
+		if !slices.Contains(valid, int(frame.PanelID)) {
+			slices.Sort(valid)
+			return fmt.Errorf("no panel with ID %d (valid IDs: %s)", frame.PanelID, joinInts(valid))
+		}
+	}
+	return nil
+}
+
+// joinInts formats ints as a comma-separated list.
+func joinInts(ints []int) string {
+	strs := make([]string, len(ints))
+	for i, n := range ints {
+		strs[i] = strconv.Itoa(n)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// promptMu serializes confirmation prompts when running against multiple
+// panels.
+var promptMu sync.Mutex
+
+// stdin reads answers to prompts. It's shared so that input buffered while
+// reading one answer is still there for the next, e.g. when piping answers
+// for several panels.
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm asks the user a yes/no question on stdin, returning true only if
+// they answer yes.
+func confirm(prompt string) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ANSI escape codes used to highlight output.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// colorize wraps s in the given ANSI color, unless colored output is
+// disabled.
+func colorize(s, color string) string {
+	if !colorOutput {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// formatPower returns s highlighted green if the Nanoleaf is on, or red if
+// it is off.
+func formatPower(s string, on bool) string {
+	if on {
+		return colorize(s, ansiGreen)
+	}
+	return colorize(s, ansiRed)
+}
+
+// effectPlugins lists the plugins supported by `effect create`.
+var effectPlugins = []string{"flow", "wheel"}
+
+// listEffectsLong prints each installed effect's name, type, and palette, as
+// hex colors, optionally filtered by a case-insensitive substring and sorted.
+func listEffectsLong(ctx context.Context, w io.Writer, client *nanoleaf.Client, format, filter string, sortList bool) error {
+	effects, err := client.GetEffectsList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed retrieve effects list: %w", err)
+	}
+	if filter != "" {
+		substr := strings.ToLower(filter)
+		effects = slices.DeleteFunc(effects, func(effect nanoleaf.EffectInfo) bool {
+			return !strings.Contains(strings.ToLower(effect.Name), substr)
+		})
+	}
+	if sortList {
+		slices.SortFunc(effects, func(a, b nanoleaf.EffectInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+	if format != "text" {
+		return render(w, format, effects)
+	}
+
+	for _, effect := range effects {
+		kind := effect.Type
+		if effect.PluginType != "" {
+			kind += "/" + effect.PluginType
+		}
+
+		palette := make([]string, len(effect.Palette))
+		for i, color := range effect.Palette {
+			red, green, blue := nanoleaf.HSVToRGB(color.Hue, color.Saturation, color.Brightness)
+			palette[i] = fmt.Sprintf("#%02x%02x%02x", red, green, blue)
+		}
+		fmt.Fprintf(w, "%-24s %-16s %s\n", effect.Name, kind, strings.Join(palette, " "))
+	}
+	return nil
+}
+
+func doEffectCreateCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("effect create", flag.ContinueOnError)
+	plugin := fs.String("plugin", "flow", "Plugin to animate the effect with (flow or wheel)")
+	trans := fs.Int("trans", 20, "Transition time between colors, in tenths of a second")
+	delay := fs.Int("delay", 0, "Time to hold each color, in tenths of a second (flow only)")
+	direction := fs.String("direction", "right", "Direction of motion (left, right, up, or down)")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() < 3 {
+		return errUsage(err, "usage: microleaf effect create [-plugin flow|wheel] [-trans <tenths>] [-delay <tenths>] [-direction left|right|up|down] <name> <color> <color> ...")
+	}
+
+	if !slices.Contains(effectPlugins, *plugin) {
+		return fmt.Errorf("plugin must be one of %s", strings.Join(effectPlugins, ", "))
+	}
+	if !slices.Contains([]string{"left", "right", "up", "down"}, *direction) {
+		return errors.New("direction must be one of left, right, up, down")
+	}
+	if *trans < 1 || *delay < 0 {
+		return errors.New("-trans must be positive and -delay must be non-negative")
+	}
+
+	var palette []nanoleaf.PaletteColor
+	for _, arg := range fs.Args()[1:] {
+		red, green, blue, err := parseColor(arg)
+		if err != nil {
+			return err
+		}
+		hue, sat, brightness := nanoleaf.RGBToHSV(red, green, blue)
+		palette = append(palette, nanoleaf.PaletteColor{Hue: hue, Saturation: sat, Brightness: brightness})
+	}
+
+	options := []nanoleaf.PluginOption{
+		{Name: "transTime", Value: *trans},
+		{Name: "linDirection", Value: *direction},
+		{Name: "loop", Value: true},
+	}
+	if *plugin == "flow" {
+		options = append(options, nanoleaf.PluginOption{Name: "delayTime", Value: *delay})
+	}
+
+	// Plugin UUIDs are looked up from the Nanoleaf rather than hardcoded,
+	// since they aren't guaranteed to be stable across firmware versions.
+	plugins, err := client.ListPlugins(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list plugins: %w", err)
+	}
+	i := slices.IndexFunc(plugins, func(p nanoleaf.Plugin) bool {
+		return p.Type == "color" && strings.EqualFold(p.Name, *plugin)
+	})
+	if i < 0 {
+		return fmt.Errorf("the Nanoleaf has no %s plugin", *plugin)
+	}
+
+	err = client.CreatePluginEffect(ctx, fs.Arg(0), plugins[i].UUID, palette, options)
+	if err != nil {
+		return fmt.Errorf("failed to create effect: %w", err)
+	}
+	return nil
+}
+
+// getEffects returns the installed effects and the selected one, from their
+// own endpoints rather than the full panel info.
+func getEffects(ctx context.Context, client *nanoleaf.Client) (*nanoleaf.Effects, error) {
+	list, err := client.ListEffects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieve effects list: %w", err)
+	}
+	selected, err := client.GetSelectedEffect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get selected effect: %w", err)
+	}
+	return &nanoleaf.Effects{Selected: selected, List: list}, nil
+}
+
+// adjacentEffect returns the effect step places from the selected effect,
+// wrapping around at either end of the list. If the selected effect isn't in
+// the list, such as a custom or temporary effect, the first effect is
+// returned.
+func adjacentEffect(effects nanoleaf.Effects, step int) string {
+	i := slices.Index(effects.List, effects.Selected)
+	if i == -1 {
+		return effects.List[0]
+	}
+	n := len(effects.List)
+	return effects.List[((i+step)%n+n)%n]
+}
+
+func doFlashCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("flash", flag.ContinueOnError)
+	loop := addLoopFlags(fs)
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf flash "+loopUsage+" [<count>] [<interval>]")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+
+	args = fs.Args()
+	if len(args) > 2 {
+		return usage(nil)
+	}
+
+	count := 3
+	if len(args) > 0 {
+		var err error
+		count, err = strconv.Atoi(args[0])
+		if err != nil || count < 1 {
+			return errors.New("count must be a positive integer")
+		}
+	}
+
+	interval := 300 * time.Millisecond
+	if len(args) > 1 {
+		var err error
+		interval, err = time.ParseDuration(args[1])
+		if err != nil || interval <= 0 {
+			return errors.New("interval must be a positive duration (e.g. 300ms)")
+		}
+	}
+
+	return loop.run(ctx, client, func(ctx context.Context, i int) error {
+		err := client.Flash(ctx, count, interval)
+		if err != nil {
+			return fmt.Errorf("failed to flash Nanoleaf: %w", err)
+		}
+		return nil
+	})
+}
+
+func doGetCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	count := fs.Int("count", 1, "Number of times to fetch the path, or 0 to fetch until interrupted")
+	interval := fs.Duration("interval", *watchInterval, "Time between fetches")
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf get [-count <n>] [-interval <duration>] <path> [<field path>]")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+	args = fs.Args()
+	if len(args) < 1 || len(args) > 2 || *count < 0 || *interval <= 0 {
+		return usage(nil)
+	}
+
+	if *count == 1 {
+		return printGetResult(ctx, w, client, args)
+	}
+
+	// Poll the path, printing each result with the time it was fetched.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+
+		fmt.Fprintf(w, "%s ", time.Now().Format(time.TimeOnly))
+		err := printGetResult(ctx, w, client, args)
+		if ctx.Err() != nil {
+			fmt.Fprintln(w)
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(w, "error:", err)
+		}
+	}
+	return nil
+}
+
+// printGetResult fetches the path in args[0] and prints the response, or
+// only the field at the optional field path in args[1].
+func printGetResult(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	res, err := client.Get(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to send GET request: %w", err)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(res))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		if len(args) > 1 {
+			return fmt.Errorf("response is not JSON: %w", err)
+		}
+		fmt.Fprintln(w, res)
+		return nil
+	}
+
+	if len(args) > 1 {
+		value, err = lookupField(value, args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Print strings bare, so they can be used directly in scripts.
+	if s, ok := value.(string); ok && !*jsonOutput {
+		fmt.Fprintln(w, s)
+		return nil
+	}
+	return printJSON(w, value)
+}
+
+// lookupField returns the value at a dotted field path, such as
+// "state.brightness.value", within a decoded JSON value. Array elements are
+// selected by index, e.g. "panelLayout.layout.positionData.0.panelId".
+func lookupField(value interface{}, path string) (interface{}, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("no field %q in %s", key, path)
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("invalid index %q in %s (array has %d elements)", key, path, len(v))
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in %s: not an object or array", key, path)
+		}
+	}
+	return value, nil
+}
+
+func doOnCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) > 1 {
+		return errUsage(nil, "usage: microleaf on [<brightness>]")
+	}
+
+	if len(args) == 0 {
+		err := client.On(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to turn on Nanoleaf: %w", err)
+		}
+		return nil
+	}
+
+	brightness, err := parseIntInRange(args[0], "brightness", 0, 100, brightnessRange(ctx, client))
+	if err != nil {
+		return err
+	}
+
+	err = client.TurnOnWithBrightness(ctx, brightness)
+	if err != nil {
+		return fmt.Errorf("failed to turn on Nanoleaf: %w", err)
+	}
+	return nil
+}
+
+func doPairCommand(args []string) {
+	if len(panelNames) != 1 || len(args) > 1 {
+		fmt.Println("usage: microleaf -n <panel_name> [-f <path>] [-profile <name>] pair [<host>]")
+		os.Exit(1)
+	}
+	panelName := panelNames[0]
+
+	cfg, path, err := readConfig()
+	if isConfigNotFound(err) {
+		cfg = &nanoleaf.MicroleafConfig{}
+		path = configFile()
+		if path == "" {
+			path = filepath.Join(configFilePath, defaultConfigFile)
+		}
+	} else if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	// With -profile, the panel is paired within that profile, which is
+	// created if necessary.
+	hostConfigs := &cfg.HostConfigs
+	var profile nanoleaf.Profile
+	if *profileFlag != "" {
+		profile = cfg.Profiles[*profileFlag]
+		hostConfigs = &profile.HostConfigs
+	}
+
+	if !*strictNames {
+		var names []string
+		for _, hostConfig := range *hostConfigs {
+			names = append(names, hostConfig.PanelName)
+		}
+		panelName, err = resolveName(panelName, names, nil)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+	}
+
+	index := -1
+	for i, hostConfig := range *hostConfigs {
+		if hostConfig.PanelName == panelName {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		*hostConfigs = append(*hostConfigs, nanoleaf.HostConfig{PanelName: panelName})
+		index = len(*hostConfigs) - 1
+	}
+	hostConfig := &(*hostConfigs)[index]
+
+	if len(args) == 1 {
+		hostConfig.Host = args[0]
+	}
+	if hostConfig.Host == "" {
+		host, err := nanoleaf.DiscoverHost(panelName, *discoverTimeout)
+		if err != nil {
+			fmt.Println("error: no host specified and discovery failed:", err)
+			os.Exit(1)
+		}
+		hostConfig.Host = host
+	}
+
+	token, err := nanoleaf.Pair(context.Background(), hostConfig.Host, *timeout)
+	if errors.Is(err, nanoleaf.ErrNotPairing) {
+		fmt.Println("error: Nanoleaf is not in pairing mode")
+		fmt.Println("Hold the power button for 5-7 seconds until the LED starts flashing, then try again within 30 seconds.")
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Println("error: failed to pair with Nanoleaf:", err)
+		os.Exit(1)
+	}
+	fmt.Println(token)
+
+	hostConfig.AccessToken = token
+	if *profileFlag != "" {
+		if cfg.Profiles == nil {
+			cfg.Profiles = make(map[string]nanoleaf.Profile)
+		}
+		cfg.Profiles[*profileFlag] = profile
+	}
+	err = writeConfig(path, cfg)
+	if err != nil {
+		fmt.Println("error: failed to write config file:", err)
+		os.Exit(1)
+	}
+}
+
+func doPanelCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	usage := func(err error) error {
+		return errUsage(err,
+			"usage: microleaf panel [-o text|json|yaml] info [-fields state,layout,rhythm,effects,versions]",
+			"       microleaf panel blink <id>",
+			"       microleaf panel [-o text|json|yaml] firmware",
+			"       microleaf panel [-o text|json|yaml] map",
+			"       microleaf panel [-o text|json|yaml] mode [hs|ct|effect]",
+			"       microleaf panel [-o text|json|yaml] model",
+			"       microleaf panel [-o text|json|yaml] name",
+			"       microleaf panel [-o text|json|yaml] orientation [<degrees>]",
+			"       microleaf panel reboot [-y]",
+			"       microleaf panel rename <name>",
+			"       microleaf panel [-o text|json|yaml] serial",
+			"       microleaf panel [-o text|json|yaml] version",
+		)
+	}
+
+	fs := flag.NewFlagSet("panel", flag.ContinueOnError)
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+	format, err := outputFormat(*output)
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	// Renaming writes to the panel, so it doesn't need the panel info.
+	if len(args) > 0 && args[0] == "rename" {
+		if len(args) != 2 {
+			return errUsage(nil, "usage: microleaf panel rename <name>")
+		}
+
+		err := client.SetName(ctx, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to rename Nanoleaf: %w", err)
+		}
+		invalidatePanelInfoCache(client.Host)
+		return nil
+	}
+
+	if len(args) > 0 && args[0] == "orientation" {
+		return doPanelOrientationCommand(ctx, w, client, format, args[1:])
+	}
+
+	if len(args) > 0 && args[0] == "reboot" {
+		return doPanelRebootCommand(ctx, client, args[1:])
+	}
+
+	if len(args) > 0 && args[0] == "mode" {
+		return doPanelModeCommand(ctx, w, client, format, args[1:])
+	}
+
+	if len(args) > 0 && args[0] == "blink" {
+		if len(args) != 2 {
+			return errUsage(nil, "usage: microleaf panel blink <id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 16)
+		if err != nil {
+			return fmt.Errorf("panel ID must be an integer 0-%d", math.MaxUint16)
+		}
+
+		err = validatePanelIDs(ctx, client, []nanoleaf.SetPanelColor{{PanelID: uint16(id)}})
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+
+		err = client.BlinkPanel(ctx, uint16(id))
+		if err != nil {
+			return fmt.Errorf("failed to blink panel: %w", err)
+		}
+		return nil
+	}
+
+	// Only info takes flags, selecting the sections to print.
+	fields := infoFields
+	if len(args) > 0 && args[0] == "info" {
+		infoFlags := flag.NewFlagSet("panel info", flag.ContinueOnError)
+		fieldList := infoFlags.String("fields", "", "Comma-separated sections to print: "+strings.Join(infoFields, ", ")+" (default all)")
+		err := parseFlags(infoFlags, args[1:])
+		if err != nil || infoFlags.NArg() != 0 {
+			return errUsage(err, "usage: microleaf panel [-o text|json|yaml] info [-fields state,layout,rhythm,effects,versions]")
+		}
+		if *fieldList != "" {
+			fields, err = parseInfoFields(*fieldList)
+			if err != nil {
+				return err
+			}
+		}
+		args = args[:1]
+	}
+
+	if len(args) != 1 {
+		return usage(nil)
+	}
+
+	command := args[0]
+
+	// The map only needs the layout, which has its own endpoint.
+	if command == "map" {
+		layout, err := client.GetLayout(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf layout: %w", err)
+		}
+		if format != "text" {
+			return render(w, format, layout)
+		}
+		fmt.Fprint(w, renderLayoutMap(layout))
+		return nil
+	}
+
+	// The state has its own, lighter endpoint; the name, model, serial
+	// number, and versions rarely change, so may be cached; everything else
+	// comes from the full panel info.
+	var panelInfo *nanoleaf.PanelInfo
+	switch command {
+	case "state":
+		state, err := client.GetState(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+		panelInfo = &nanoleaf.PanelInfo{State: *state}
+	case "firmware", "model", "name", "serial", "version":
+		var err error
+		panelInfo, err = cachedPanelInfo(ctx, client)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+	default:
+		var err error
+		panelInfo, err = client.GetPanelInfo(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+	}
+
+	if outputTemplate != nil && command == "info" {
+		return printTemplate(w, panelInfo)
+	}
+
+	if format != "text" {
+		switch command {
+		case "firmware":
+			return render(w, format, panelInfo.FirmwareVersion)
+		case "info":
+			if len(fields) < len(infoFields) {
+				return render(w, format, selectInfoFields(panelInfo, fields))
+			}
+			return render(w, format, panelInfo)
+		case "layout":
+			return render(w, format, panelInfo.PanelLayout)
+		case "model":
+			return render(w, format, panelInfo.Model)
+		case "name":
+			return render(w, format, panelInfo.Name)
+		case "serial":
+			return render(w, format, panelInfo.SerialNo)
+		case "state":
+			return render(w, format, panelInfo.State)
+		case "version":
+			return render(w, format, panelVersions{
+				FirmwareVersion:       panelInfo.FirmwareVersion,
+				RhythmHardwareVersion: panelInfo.Rhythm.HardwareVersion,
+				RhythmFirmwareVersion: panelInfo.Rhythm.FirmwareVersion,
+			})
+		default:
+			return usage(nil)
+		}
+	}
+
+	switch command {
+	case "info":
+		fmt.Fprintln(w, "Name:", panelInfo.Name)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Manufacturer:", panelInfo.Manufacturer)
+		fmt.Fprintln(w, "Model:       ", panelInfo.Model)
+		fmt.Fprintln(w, "Serial No:   ", panelInfo.SerialNo)
+		fmt.Fprintln(w)
+		if slices.Contains(fields, "versions") {
+			fmt.Fprintln(w, "Firmware Version:", panelInfo.FirmwareVersion)
+			fmt.Fprintln(w)
+		}
+		if slices.Contains(fields, "state") {
+			fmt.Fprintln(w, "State:")
+			fmt.Fprintln(w, "  On:  ", formatPower(strconv.FormatBool(panelInfo.State.On.Value), panelInfo.State.On.Value))
+			fmt.Fprintln(w, "  Mode:", panelInfo.State.ColorMode)
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "  Hue:        %3d° [%d°-%d°]\n", panelInfo.State.Hue.Value, *panelInfo.State.Hue.Min, *panelInfo.State.Hue.Max)
+			fmt.Fprintf(w, "  Saturation: %3d  [%d-%d]\n", panelInfo.State.Saturation.Value, *panelInfo.State.Saturation.Min, *panelInfo.State.Saturation.Max)
+			fmt.Fprintf(w, "  Brightness: %3d  [%d-%d]\n", panelInfo.State.Brightness.Value, *panelInfo.State.Brightness.Min, *panelInfo.State.Brightness.Max)
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "  Color Temperature: %4dK [%dK-%dK]\n", panelInfo.State.ColorTemperature.Value, *panelInfo.State.ColorTemperature.Min, *panelInfo.State.ColorTemperature.Max)
+			fmt.Fprintln(w)
+		}
+		if slices.Contains(fields, "effects") {
+			fmt.Fprintln(w, "Effects:")
+			fmt.Fprintln(w, "  Selected:", panelInfo.Effects.Selected)
+			fmt.Fprintln(w, "  Available:")
+			for _, effect := range panelInfo.Effects.List {
+				fmt.Fprintln(w, "  -", effect)
+			}
+			fmt.Fprintln(w)
+		}
+		if slices.Contains(fields, "layout") {
+			fmt.Fprintln(w, "Layout:")
+			fmt.Fprintf(w, "  Orientation: %d° [%d°-%d°]\n", panelInfo.PanelLayout.GlobalOrientation.Value, panelInfo.PanelLayout.GlobalOrientation.Min, panelInfo.PanelLayout.GlobalOrientation.Max)
+			fmt.Fprintln(w, "  Panels:     ", panelInfo.PanelLayout.Layout.NumPanels)
+			fmt.Fprintln(w, "  Side Length:", panelInfo.PanelLayout.Layout.SideLength)
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "  Panel Positions:")
+			for _, panel := range panelInfo.PanelLayout.Layout.PositionData {
+				fmt.Fprintf(w, "  - %3d: (%d, %d, %d°)\n", panel.PanelID, panel.X, panel.Y, panel.O)
+			}
+			fmt.Fprintln(w)
+		}
+		if slices.Contains(fields, "rhythm") {
+			fmt.Fprintln(w, "Rhythm:")
+			fmt.Fprintln(w, "  ID:      ", panelInfo.Rhythm.ID)
+			fmt.Fprintf(w, "  Position: (%.0f, %.0f, %.0f°)\n", panelInfo.Rhythm.Position.X, panelInfo.Rhythm.Position.Y, panelInfo.Rhythm.Position.O)
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "  Connected:    ", panelInfo.Rhythm.Connected)
+			fmt.Fprintln(w, "  Aux Available:", panelInfo.Rhythm.AuxAvailable)
+			fmt.Fprintln(w, "  Active:       ", panelInfo.Rhythm.Active)
+			fmt.Fprintln(w, "  Mode:         ", panelInfo.Rhythm.Mode)
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "  Versions:")
+			fmt.Fprintln(w, "    Hardware:", panelInfo.Rhythm.HardwareVersion)
+			fmt.Fprintln(w, "    Firmware:", panelInfo.Rhythm.FirmwareVersion)
+			fmt.Fprintln(w)
+		}
+	case "layout":
+		fmt.Fprintf(w, "Orientation: %d° [%d°-%d°]\n", panelInfo.PanelLayout.GlobalOrientation.Value, panelInfo.PanelLayout.GlobalOrientation.Min, panelInfo.PanelLayout.GlobalOrientation.Max)
+		fmt.Fprintln(w, "Panels:     ", panelInfo.PanelLayout.Layout.NumPanels)
+		fmt.Fprintln(w, "Side Length:", panelInfo.PanelLayout.Layout.SideLength)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Positions:")
+		for _, panel := range panelInfo.PanelLayout.Layout.PositionData {
+			fmt.Fprintf(w, "- %3d: (%d, %d, %d°)\n", panel.PanelID, panel.X, panel.Y, panel.O)
+		}
+		fmt.Fprintln(w)
+	case "firmware":
+		fmt.Fprintln(w, panelInfo.FirmwareVersion)
+	case "model":
+		fmt.Fprintln(w, panelInfo.Model)
+	case "name":
+		fmt.Fprintln(w, panelInfo.Name)
+	case "serial":
+		fmt.Fprintln(w, panelInfo.SerialNo)
+	case "state":
+		fmt.Fprintln(w, "On:  ", formatPower(strconv.FormatBool(panelInfo.State.On.Value), panelInfo.State.On.Value))
+		fmt.Fprintln(w, "Mode:", panelInfo.State.ColorMode)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Brightness: %3d [%d-%d]\n", panelInfo.State.Brightness.Value, *panelInfo.State.Brightness.Min, *panelInfo.State.Brightness.Max)
+		fmt.Fprintf(w, "Hue:        %3d [%d-%d]\n", panelInfo.State.Hue.Value, *panelInfo.State.Hue.Min, *panelInfo.State.Hue.Max)
+		fmt.Fprintf(w, "Saturation: %3d [%d-%d]\n", panelInfo.State.Saturation.Value, *panelInfo.State.Saturation.Min, *panelInfo.State.Saturation.Max)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Color Temperature: %4dK [%dK-%dK]\n", panelInfo.State.ColorTemperature.Value, *panelInfo.State.ColorTemperature.Min, *panelInfo.State.ColorTemperature.Max)
+		fmt.Fprintln(w)
+	case "version":
+		fmt.Fprintln(w, "Panel Firmware:", panelInfo.FirmwareVersion)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Rhythm:")
+		fmt.Fprintln(w, "  Hardware:", panelInfo.Rhythm.HardwareVersion)
+		fmt.Fprintln(w, "  Firmware:", panelInfo.Rhythm.FirmwareVersion)
+		fmt.Fprintln(w)
+	default:
+		return usage(nil)
+	}
+	return nil
+}
+
+// infoFields are the sections of the panel info that `panel info -fields`
+// can select, in the order they're printed.
+var infoFields = []string{"versions", "state", "effects", "layout", "rhythm"}
+
+// parseInfoFields parses a comma-separated list of panel info sections,
+// returning an error if any are unknown.
+func parseInfoFields(list string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !slices.Contains(infoFields, field) {
+			return nil, fmt.Errorf("unknown panel info field %q (must be one of: %s)", field, strings.Join(infoFields, ", "))
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// selectInfoFields returns the panel's identity and the selected sections of
+// its info, keyed by their JSON field names, for structured output.
+func selectInfoFields(panelInfo *nanoleaf.PanelInfo, fields []string) map[string]interface{} {
+	selected := map[string]interface{}{
+		"name":         panelInfo.Name,
+		"serialNo":     panelInfo.SerialNo,
+		"manufacturer": panelInfo.Manufacturer,
+		"model":        panelInfo.Model,
+	}
+	for _, field := range fields {
+		switch field {
+		case "versions":
+			selected["firmwareVersion"] = panelInfo.FirmwareVersion
+		case "state":
+			selected["state"] = panelInfo.State
+		case "effects":
+			selected["effects"] = panelInfo.Effects
+		case "layout":
+			selected["panelLayout"] = panelInfo.PanelLayout
+		case "rhythm":
+			selected["rhythm"] = panelInfo.Rhythm
+		}
+	}
+	return selected
+}
+
+// doPanelModeCommand prints the Nanoleaf's color mode, or switches it if
+// given.
+func doPanelModeCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, format string, args []string) error {
+	if len(args) > 1 {
+		return errUsage(nil, "usage: microleaf panel mode [hs|ct|effect]")
+	}
+
+	if len(args) == 0 {
+		state, err := client.GetState(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+		if format != "text" {
+			return render(w, format, state.ColorMode)
+		}
+		fmt.Fprintln(w, state.ColorMode)
+		return nil
+	}
+
+	mode := args[0]
+	if mode != "hs" && mode != "ct" && mode != "effect" {
+		return errors.New("mode must be hs, ct, or effect")
+	}
+	err := client.SetColorMode(ctx, mode)
+	if err != nil {
+		return fmt.Errorf("failed to set color mode: %w", err)
+	}
+	return nil
+}
+
+// doPanelOrientationCommand prints the layout's global orientation, or sets
+// it if given, checking it against the range the Nanoleaf reports.
+func doPanelOrientationCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, format string, args []string) error {
+	if len(args) > 1 {
+		return errUsage(nil, "usage: microleaf panel orientation [<degrees>]")
+	}
+
+	orientation, err := client.GetGlobalOrientation(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf orientation: %w", err)
+	}
+
+	if len(args) == 0 {
+		if format != "text" {
+			return render(w, format, orientation)
+		}
+		fmt.Fprintf(w, "%d° [%d°-%d°]\n", orientation.Value, orientation.Min, orientation.Max)
+		return nil
+	}
+
+	degrees, err := parseIntInRange(args[0], "orientation", orientation.Min, orientation.Max, nil)
+	if err != nil {
+		return err
+	}
+	err = client.SetGlobalOrientation(ctx, degrees)
+	if err != nil {
+		return fmt.Errorf("failed to set Nanoleaf orientation: %w", err)
+	}
+	return nil
+}
+
+// doPanelRebootCommand restarts the Nanoleaf's controller, after asking for
+// confirmation unless -y is given.
+func doPanelRebootCommand(ctx context.Context, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("panel reboot", flag.ContinueOnError)
+	yes := fs.Bool("y", false, "Reboot without asking for confirmation")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage(err, "usage: microleaf panel reboot [-y]")
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("Reboot %s?", client.Host)) {
+		return nil
+	}
+
+	err = client.Reboot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reboot Nanoleaf: %w", err)
+	}
+	return nil
+}
+
+// panelVersions is the JSON output of `panel version`.
+type panelVersions struct {
+	FirmwareVersion       string `json:"firmwareVersion"`
+	RhythmHardwareVersion string `json:"rhythmHardwareVersion"`
+	RhythmFirmwareVersion string `json:"rhythmFirmwareVersion"`
+}
+
+// printTemplate writes panelInfo to w formatted with the -template template,
+// ending with a newline.
+func printTemplate(w io.Writer, panelInfo *nanoleaf.PanelInfo) error {
+	var buf bytes.Buffer
+	err := outputTemplate.Execute(&buf, panelInfo)
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+func doPostCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage(nil, "usage: microleaf post <path> [<file>]")
+	}
+
+	body, err := readBody(args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	res, err := client.Post(ctx, args[0], body)
+	if err != nil {
+		return fmt.Errorf("failed to send POST request: %w", err)
+	}
+
+	fmt.Fprintln(w, res)
+	return nil
+}
+
+func doPulseCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("pulse", flag.ContinueOnError)
+	loop := addLoopFlags(fs)
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf pulse "+loopUsage+" [<cycles>] [<period>]")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+
+	args = fs.Args()
+	if len(args) > 2 {
+		return usage(nil)
+	}
+
+	cycles := 3
+	if len(args) > 0 {
+		var err error
+		cycles, err = strconv.Atoi(args[0])
+		if err != nil || cycles < 1 {
+			return errors.New("cycles must be a positive integer")
+		}
+	}
+
+	period := 4 * time.Second
+	if len(args) > 1 {
+		var err error
+		period, err = time.ParseDuration(args[1])
+		if err != nil || period <= 0 {
+			return errors.New("period must be a positive duration (e.g. 4s)")
+		}
+	}
+
+	return loop.run(ctx, client, func(ctx context.Context, i int) error {
+		err := client.Pulse(ctx, cycles, period)
+		if err != nil {
+			return fmt.Errorf("failed to pulse Nanoleaf: %w", err)
+		}
+		return nil
+	})
+}
+
+func doPutCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage(nil, "usage: microleaf put <path> [<file>]")
+	}
+
+	body, err := readBody(args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	// The body may be a relative change, so it mustn't be retried.
+	res, err := client.PutOnce(ctx, args[0], body)
+	if err != nil {
+		return fmt.Errorf("failed to send PUT request: %w", err)
+	}
+
+	fmt.Fprintln(w, res)
+	return nil
+}
+
+// readBody reads a request body from the file named by args, or from stdin if
+// no file (or "-") is given.
+func readBody(args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(args[0])
+}
+
+func doGradientCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("gradient", flag.ContinueOnError)
+	axis := fs.String("axis", "x", "Axis to spread the gradient along (x or y)")
+	order := fs.String("order", "", "Comma-separated panel IDs to spread the gradient along, in order, instead of an axis")
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf gradient [-axis x|y | -order <id>,<id>,...] <start color> <end color>")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+
+	if fs.NArg() != 2 || (*order != "" && isFlagSetIn(fs, "axis")) {
+		return usage(nil)
+	}
+	if *axis != "x" && *axis != "y" {
+		return errors.New("axis must be x or y")
+	}
+
+	var from, to [3]int
+	var err error
+	from[0], from[1], from[2], err = parseColor(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to[0], to[1], to[2], err = parseColor(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	layout, err := client.GetLayout(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf layout: %w", err)
+	}
+
+	panels, err := orderedPanels(layout, *axis, *order)
+	if err != nil {
+		return err
+	}
+	if *order != "" {
+		*axis = ""
+	}
+
+	err = client.SetCustomColors(ctx, gradientFrames(panels, *axis, from, to))
+	if err != nil {
+		return fmt.Errorf("failed to set gradient: %w", err)
+	}
+	return nil
+}
+
+func doHSLCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return errUsage(nil, "usage: microleaf hsl <hue> <saturation> <lightness> [<duration>]")
+	}
+
+	hue, err := parseIntInRange(args[0], "hue", 0, 360, nil)
+	if err != nil {
+		return err
+	}
+	sat, err := parseIntInRange(args[1], "saturation", 0, 100, nil)
+	if err != nil {
+		return err
+	}
+	lightness, err := parseIntInRange(args[2], "lightness", 0, 100, nil)
+	if err != nil {
+		return err
+	}
+
+	duration := 0
+	if len(args) > 3 {
+		duration, err = parseDuration(args[3])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.SetHSL(ctx, hue, sat, lightness, duration)
+	if err != nil {
+		return fmt.Errorf("failed to set HSL: %w", err)
+	}
+	return nil
+}
+
+func doHSVCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("hsv", flag.ContinueOnError)
+	panel := fs.Int("panel", -1, "ID of a single panel to color")
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf hsv [-panel <id>] <hue> <saturation> <brightness> [<duration>]")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+	args = fs.Args()
+	if len(args) != 3 && len(args) != 4 {
+		return usage(nil)
+	}
+
+	hue, err := parseIntInRange(args[0], "hue", 0, 360, nil)
+	if err != nil {
+		return err
+	}
+	sat, err := parseIntInRange(args[1], "saturation", 0, 100, nil)
+	if err != nil {
+		return err
+	}
+	brightness, err := parseIntInRange(args[2], "brightness", 0, 100, nil)
+	if err != nil {
+		return err
+	}
+
+	duration := 0
+	if len(args) > 3 {
+		duration, err = parseDuration(args[3])
+		if err != nil {
+			return err
+		}
+	}
+
+	if *panel != -1 {
+		red, green, blue := nanoleaf.HSVToRGB(hue, sat, brightness)
+		return setPanelColor(ctx, client, *panel, red, green, blue, duration)
+	}
+
+	err = client.SetHSV(ctx, hue, sat, brightness, duration)
 	if err != nil {
-		fmt.Println("error: failed to set RGB:", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to set HSV: %w", err)
+	}
+	return nil
+}
+
+func doRainbowCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("rainbow", flag.ContinueOnError)
+	axis := fs.String("axis", "x", "Axis to spread the rainbow along (x or y)")
+	sat := fs.Int("saturation", 100, "Saturation (0-100)")
+	brightness := fs.Int("brightness", 100, "Brightness (0-100)")
+	order := fs.String("order", "", "Comma-separated panel IDs to spread the rainbow along, in order, instead of an axis")
+	step := fs.Duration("step", time.Second, "Time to rotate the rainbow by one panel, with -loop or -repeat")
+	loop := addLoopFlags(fs)
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf rainbow [-axis x|y | -order <id>,<id>,...] [-saturation <saturation>] [-brightness <brightness>] [-step <duration>] "+loopUsage)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+
+	if fs.NArg() != 0 || (*order != "" && isFlagSetIn(fs, "axis")) {
+		return usage(nil)
+	}
+	if *axis != "x" && *axis != "y" {
+		return errors.New("axis must be x or y")
+	}
+	if *sat < 0 || *sat > 100 {
+		return errors.New("saturation must be an integer 0-100")
+	}
+	if *brightness < 0 || *brightness > 100 {
+		return errors.New("brightness must be an integer 0-100")
+	}
+
+	layout, err := client.GetLayout(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf layout: %w", err)
+	}
+
+	panels, err := orderedPanels(layout, *axis, *order)
+	if err != nil {
+		return err
+	}
+
+	if *step <= 0 {
+		return errors.New("step must be a positive duration (e.g. 1s)")
+	}
+
+	// A single rainbow is static; repeating it rotates the hues along the
+	// panels, one panel per repetition.
+	if !*loop.loop && *loop.repeat == 1 {
+		err = client.SetCustomColors(ctx, rainbowFrames(panels, 0, *sat, *brightness, 1))
+		if err != nil {
+			return fmt.Errorf("failed to set rainbow: %w", err)
+		}
+		return nil
+	}
+
+	defer client.Close()
+	transition := uint16(min(step.Milliseconds()/100, math.MaxUint16))
+	return loop.run(ctx, client, func(ctx context.Context, i int) error {
+		offset := 360 * (i % len(panels)) / len(panels)
+		err := client.StreamPanelColors(ctx, rainbowFrames(panels, offset, *sat, *brightness, transition))
+		if err != nil {
+			return fmt.Errorf("failed to set rainbow: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*step):
+		}
+		return nil
+	})
+}
+
+// orderedPanels returns the layout's panels in the order given by -order, if
+// set, or else by their position along axis.
+func orderedPanels(layout *nanoleaf.Layout, axis, order string) ([]nanoleaf.PanelPosition, error) {
+	if order != "" {
+		return panelsInOrder(layout, order)
+	}
+	return panelsAlong(layout, axis)
+}
+
+func doRestoreCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage(nil, "usage: microleaf restore <file>")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot nanoleaf.Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	err = client.Restore(ctx, &snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to restore state: %w", err)
+	}
+	return nil
+}
+
+func doRGBCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("rgb", flag.ContinueOnError)
+	panel := fs.Int("panel", -1, "ID of a single panel to color")
+	usage := func(err error) error {
+		return errUsage(err,
+			"usage: microleaf rgb [-panel <id>] <red> <green> <blue> [<duration>]",
+			"       microleaf rgb [-panel <id>] <hex|name> [<duration>]",
+		)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+	args = fs.Args()
+
+	var red, green, blue int
+	var err error
+	duration := 0
+	switch len(args) {
+	case 1, 2:
+		red, green, blue, err = parseColor(args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) > 1 {
+			duration, err = parseDuration(args[1])
+		}
+	case 3, 4:
+		red, green, blue, err = parseRGB(args[:3])
+		if err == nil && len(args) > 3 {
+			duration, err = parseDuration(args[3])
+		}
+	default:
+		return usage(nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *panel != -1 {
+		return setPanelColor(ctx, client, *panel, red, green, blue, duration)
+	}
+
+	err = client.SetRGB(ctx, red, green, blue, duration)
+	if err != nil {
+		return fmt.Errorf("failed to set RGB: %w", err)
+	}
+	return nil
+}
+
+// parseRGB parses red, green, and blue values from args, which must have
+// exactly three elements.
+func parseRGB(args []string) (red, green, blue int, err error) {
+	values := make([]int, 3)
+	for i, name := range []string{"red", "green", "blue"} {
+		values[i], err = parseIntInRange(args[i], name, 0, 255, nil)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return values[0], values[1], values[2], nil
+}
+
+// setPanelColor sets a single panel's color, transitioning over duration
+// seconds, leaving the other panels unchanged.
+func setPanelColor(ctx context.Context, client *nanoleaf.Client, panel, red, green, blue, duration int) error {
+	if panel < 0 || panel > math.MaxUint16 {
+		return fmt.Errorf("panel ID must be an integer 0-%d", math.MaxUint16)
+	}
+
+	// External control transition times are in tenths of a second.
+	transitionTime := max(1, duration*10)
+	if transitionTime > math.MaxUint16 {
+		return fmt.Errorf("duration must be at most %d seconds", math.MaxUint16/10)
+	}
+
+	err := client.SetCustomColors(ctx, []nanoleaf.SetPanelColor{{
+		PanelID:        uint16(panel),
+		Red:            uint8(red),
+		Green:          uint8(green),
+		Blue:           uint8(blue),
+		TransitionTime: uint16(transitionTime),
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to set panel color: %w", err)
+	}
+	return nil
+}
+
+// standaloneCommands can't be used in scripts or scenes, since they don't act
+// on the selected panels, or, for run, could run themselves.
+var standaloneCommands = []string{"completion", "discover", "pair", "run", "version"}
+
+// scriptLine is a single command in a script run by the run command.
+type scriptLine struct {
+	number int
+	args   []string
+}
+
+func doRunCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cont := fs.Bool("continue", false, "Keep running after a command fails")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 1 {
+		return errUsage(err, "usage: microleaf run [-continue] <file>")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+
+	// Parse the whole script up front so that a typo on a later line
+	// doesn't leave the Nanoleaf half way through a sequence.
+	script, err := parseScript(string(data))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, line := range script {
+		err := runCommand(ctx, w, client, line.args[0], line.args[1:])
+		if err != nil {
+			printUsage(w, err)
+			err = fmt.Errorf("line %d: %w", line.number, err)
+			if !*cont {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseScript parses a script for the run command into its commands,
+// skipping blank lines and comments, and checks that each command can be run
+// in a script.
+func parseScript(data string) ([]scriptLine, error) {
+	var script []scriptLine
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lineArgs, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch cmd := lineArgs[0]; {
+		case slices.Contains(standaloneCommands, cmd):
+			return nil, fmt.Errorf("line %d: %s can't be used in a script", i+1, cmd)
+		case !slices.Contains(commands, cmd):
+			return nil, fmt.Errorf("line %d: %w", i+1, unknownCommandError(cmd))
+		}
+		script = append(script, scriptLine{number: i + 1, args: lineArgs})
+	}
+	return script, nil
+}
+
+func doSceneCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage(nil, "usage: microleaf scene <name>")
+	}
+	if config == nil {
+		return errors.New("scenes are defined in the config file, which isn't used with -host and -token")
+	}
+
+	scene, ok := config.Scenes[args[0]]
+	if !ok {
+		if len(config.Scenes) == 0 {
+			return fmt.Errorf("no scene named %q: the config file has no scenes", args[0])
+		}
+		names := slices.Sorted(maps.Keys(config.Scenes))
+		return fmt.Errorf("no scene named %q (scenes: %s)", args[0], strings.Join(names, ", "))
+	}
+
+	// Scenes were checked when the config was validated.
+	for i, step := range scene {
+		stepArgs, _ := splitArgs(step)
+		err := runCommand(ctx, w, client, stepArgs[0], stepArgs[1:])
+		if err != nil {
+			printUsage(w, err)
+			return fmt.Errorf("scene %s, step %d (%s): %w", args[0], i+1, step, err)
+		}
+	}
+	return nil
+}
+
+// checkSceneCommand returns an error if cmd can't be used in a scene.
+func checkSceneCommand(cmd string) error {
+	switch {
+	case cmd == "scene" || slices.Contains(standaloneCommands, cmd):
+		return fmt.Errorf("%s can't be used in a scene", cmd)
+	case !slices.Contains(commands, cmd):
+		return unknownCommandError(cmd)
+	}
+	return nil
+}
+
+// splitArgs splits a script line into arguments on whitespace. Single or
+// double quotes group words containing whitespace into one argument.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func doSaveCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage(nil, "usage: microleaf save <file>")
+	}
+
+	snapshot, err := client.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	err = os.WriteFile(args[0], append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+func doPingCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage(nil, "usage: microleaf ping")
+	}
+
+	start := time.Now()
+	_, err := client.GetState(ctx)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	var apiErr *nanoleaf.APIError
+	switch {
+	case err == nil:
+		fmt.Fprintf(w, "ok (%s)\n", elapsed)
+		return nil
+	case errors.Is(err, nanoleaf.ErrUnauthorized) || (errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden):
+		return &exitError{code: exitUnauthorized, err: fmt.Errorf("unauthorized: %w", err)}
+	case errors.As(err, &apiErr):
+		return fmt.Errorf("unhealthy: %w", err)
+	default:
+		return &exitError{code: exitUnreachable, err: fmt.Errorf("unreachable: %w", err)}
+	}
+}
+
+func doStatusCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage(nil, "usage: microleaf status")
+	}
+
+	if outputTemplate != nil {
+		panelInfo, err := client.GetPanelInfo(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+		}
+		return printTemplate(w, panelInfo)
+	}
+
+	snapshot, err := client.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf state: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(w, snapshot)
+	}
+
+	power := "OFF"
+	if snapshot.On {
+		power = "ON "
+	}
+	fmt.Fprintf(w, "%s  bri=%d  mode=%s  effect=%q\n",
+		formatPower(power, snapshot.On), snapshot.Brightness, snapshot.ColorMode, snapshot.Effect)
+	return nil
+}
+
+// rangeFunc returns the bounds the Nanoleaf reports for a value, or false if
+// they aren't known.
+type rangeFunc func() (lo, hi int, ok bool)
+
+// isIncrement reports whether arg is a relative increment, such as +10 or
+// -10, rather than an absolute value.
+func isIncrement(arg string) bool {
+	return strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-")
+}
+
+// parseIntInRange parses an integer argument, returning an error if it is
+// invalid or outside lo-hi. With -clamp, out-of-range values are instead
+// clamped to the bounds reported by device, if not nil, or lo-hi otherwise.
+// The argument may be prefixed with "=", so that negative values such as =-5
+// can be given where -5 would be taken for an increment.
+func parseIntInRange(s, name string, lo, hi int, device rangeFunc) (int, error) {
+	value, err := strconv.Atoi(strings.TrimPrefix(s, "="))
+	if err == nil && *clampValues {
+		// The Nanoleaf may support a narrower range than lo-hi, so always
+		// consult its bounds.
+		if device != nil {
+			if deviceLo, deviceHi, ok := device(); ok {
+				lo, hi = deviceLo, deviceHi
+			}
+		}
+		value = max(lo, min(value, hi))
+	}
+	if err != nil || value < lo || value > hi {
+		return 0, fmt.Errorf("%s must be an integer %d-%d", name, lo, hi)
+	}
+	return value, nil
+}
+
+// stateRange returns a rangeFunc that looks up the bounds of a state
+// property, as selected by bounds, from the Nanoleaf.
+func stateRange(ctx context.Context, client *nanoleaf.Client, bounds func(*nanoleaf.State) (lo, hi *int)) rangeFunc {
+	return func() (int, int, bool) {
+		state, err := client.GetState(ctx)
+		if err != nil {
+			return 0, 0, false
+		}
+		lo, hi := bounds(state)
+		if lo == nil || hi == nil {
+			return 0, 0, false
+		}
+		return *lo, *hi, true
+	}
+}
+
+func hueBounds(state *nanoleaf.State) (*int, *int) {
+	if state.Hue == nil {
+		return nil, nil
+	}
+	return state.Hue.Min, state.Hue.Max
+}
+
+func saturationBounds(state *nanoleaf.State) (*int, *int) {
+	if state.Saturation == nil {
+		return nil, nil
+	}
+	return state.Saturation.Min, state.Saturation.Max
+}
+
+// brightnessRange returns a rangeFunc for the Nanoleaf's supported
+// brightnesses, sharing the client's cached range with SetBrightness.
+func brightnessRange(ctx context.Context, client *nanoleaf.Client) rangeFunc {
+	return func() (int, int, bool) {
+		lo, hi, err := client.BrightnessRange(ctx)
+		return lo, hi, err == nil
+	}
+}
+
+// temperatureRange returns a rangeFunc for the Nanoleaf's supported color
+// temperatures, sharing the client's cached range with SetColorTemperature.
+func temperatureRange(ctx context.Context, client *nanoleaf.Client) rangeFunc {
+	return func() (int, int, bool) {
+		lo, hi, err := client.ColorTemperatureRange(ctx)
+		return lo, hi, err == nil
+	}
+}
+
+// parseDuration parses a transition duration argument into seconds,
+// returning an error on invalid input. It is either a number of seconds or a
+// duration such as "2s" or "1m", which must be a whole number of seconds.
+func parseDuration(s string) (int, error) {
+	if duration, err := strconv.Atoi(s); err == nil && duration >= 0 {
+		return duration, nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil || duration < 0 || duration%time.Second != 0 {
+		return 0, errors.New("duration must be a non-negative whole number of seconds (e.g. 30 or 30s)")
+	}
+	return int(duration / time.Second), nil
+}
+
+// parseColor parses a CSS color name or hex color string into its red, green,
+// and blue values.
+func parseColor(s string) (int, int, int, error) {
+	if rgb, ok := namedColors[strings.ToLower(s)]; ok {
+		return rgb[0], rgb[1], rgb[2], nil
+	}
+
+	// Bare hex must be the long form, so that short words like "bad" and
+	// "fed" aren't taken for colors.
+	if strings.HasPrefix(s, "#") || (len(s) == 6 && strings.Trim(s, "0123456789abcdefABCDEF") == "") {
+		return parseHexColor(s)
+	}
+	return 0, 0, 0, fmt.Errorf("unrecognized color name %q", s)
+}
+
+// parseHexColor parses a hex color string of the form "#rrggbb" or "#rgb"
+// into its red, green, and blue values. The leading "#" is optional for the
+// long form only.
+func parseHexColor(s string) (int, int, int, error) {
+	hex, hasHash := strings.CutPrefix(s, "#")
+	if len(hex) == 3 && hasHash {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: expected \"#rrggbb\", \"rrggbb\", or \"#rgb\"", s)
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: contains non-hex characters", s)
+	}
+
+	return int(value >> 16 & 0xff), int(value >> 8 & 0xff), int(value & 0xff), nil
+}
+
+func doTouchCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 1 || args[0] != "watch" {
+		return errUsage(nil, "usage: microleaf touch watch")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	events, err := client.SubscribeTouch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to touch events: %w", err)
+	}
+
+	for event := range events {
+		timestamp := time.Now().Format(time.TimeOnly)
+		if event.PanelID < 0 {
+			fmt.Fprintf(w, "%s %s\n", timestamp, event.Gesture)
+		} else {
+			fmt.Fprintf(w, "%s panel %d %s\n", timestamp, event.PanelID, event.Gesture)
+		}
+	}
+	if ctx.Err() == nil {
+		return errors.New("touch event stream ended unexpectedly")
+	}
+	return nil
+}
+
+// watchState is the subset of Nanoleaf state reported by `watch`.
+type watchState struct {
+	On         bool
+	Brightness int
+	ColorMode  string
+	Effect     string
+}
+
+func doWatchCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage(nil, "usage: microleaf [-interval <duration>] watch")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(*watchInterval)
+	defer ticker.Stop()
+
+	var last *watchState
+	for {
+		panelInfo, err := client.GetPanelInfo(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(w, "error: failed to get Nanoleaf state:", err)
+		} else {
+			state := watchState{
+				ColorMode: panelInfo.State.ColorMode,
+				Effect:    panelInfo.Effects.Selected,
+			}
+			if panelInfo.State.On != nil {
+				state.On = panelInfo.State.On.Value
+			}
+			if panelInfo.State.Brightness != nil {
+				state.Brightness = panelInfo.State.Brightness.Value
+			}
+
+			if last == nil || state != *last {
+				fmt.Fprintf(w, "%s on=%t brightness=%d mode=%s effect=%q\n",
+					time.Now().Format(time.TimeOnly), state.On, state.Brightness, state.ColorMode, state.Effect)
+				last = &state
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func doWipeCommand(ctx context.Context, w io.Writer, client *nanoleaf.Client, args []string) error {
+	fs := flag.NewFlagSet("wipe", flag.ContinueOnError)
+	axis := fs.String("axis", "x", "Axis to sweep the color along (x or y)")
+	reverse := fs.Bool("reverse", false, "Sweep from the far end of the axis")
+	usage := func(err error) error {
+		return errUsage(err, "usage: microleaf wipe [-axis x|y] [-reverse] <color> [<delay>]")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usage(err)
+	}
+
+	args = fs.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return usage(nil)
+	}
+	if *axis != "x" && *axis != "y" {
+		return errors.New("axis must be x or y")
+	}
+
+	red, green, blue, err := parseColor(args[0])
+	if err != nil {
+		return err
+	}
+
+	delay := 100 * time.Millisecond
+	if len(args) > 1 {
+		delay, err = time.ParseDuration(args[1])
+		if err != nil || delay <= 0 {
+			return errors.New("delay must be a positive duration (e.g. 100ms)")
+		}
+	}
+
+	layout, err := client.GetLayout(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Nanoleaf layout: %w", err)
+	}
+	panels, err := panelsAlong(layout, *axis)
+	if err != nil {
+		return err
+	}
+	if *reverse {
+		slices.Reverse(panels)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// Stream one panel per frame, so the panels already colored keep
+	// their color. If interrupted, the wipe is left part way through.
+	defer client.Close()
+	transition := uint16(min(delay.Milliseconds()/100, math.MaxUint16))
+	for i, panel := range panels {
+		err := client.StreamPanelColors(ctx, []nanoleaf.SetPanelColor{{
+			PanelID:        uint16(panel.PanelID),
+			Red:            uint8(red),
+			Green:          uint8(green),
+			Blue:           uint8(blue),
+			TransitionTime: transition,
+		}})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set panel color: %w", err)
+		}
+
+		if i < len(panels)-1 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+		}
 	}
+	return nil
 }
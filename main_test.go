@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+)
+
+func TestParseIntInRange(t *testing.T) {
+	deviceRange := func() (int, int, bool) { return 10, 90, true }
+	unknownRange := func() (int, int, bool) { return 0, 0, false }
+	tests := []struct {
+		name   string
+		s      string
+		clamp  bool
+		device rangeFunc
+		value  int
+		err    bool
+	}{
+		{"in range", "50", false, nil, 50, false},
+		{"absolute", "=50", false, nil, 50, false},
+		{"too high", "101", false, nil, 0, true},
+		{"too low", "=-1", false, nil, 0, true},
+		{"not an integer", "bright", false, nil, 0, true},
+		{"clamped high", "101", true, nil, 100, false},
+		{"clamped low", "=-1", true, nil, 0, false},
+		{"clamped to device range", "95", true, deviceRange, 90, false},
+		{"clamped up to device range", "=-5", true, deviceRange, 10, false},
+		{"device range unknown", "101", true, unknownRange, 100, false},
+		{"device range without clamp", "95", false, deviceRange, 95, false},
+		{"clamped but not an integer", "bright", true, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := *clampValues
+			t.Cleanup(func() { *clampValues = saved })
+			*clampValues = tt.clamp
+
+			value, err := parseIntInRange(tt.s, "brightness", 0, 100, tt.device)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseIntInRange(%q) error = %v, want error: %t", tt.s, err, tt.err)
+			}
+			if value != tt.value {
+				t.Errorf("parseIntInRange(%q) = %d, want %d", tt.s, value, tt.value)
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		args []string
+	}{
+		{"words", "brightness 50 2", []string{"brightness", "50", "2"}},
+		{"extra whitespace", "  on \t 80  ", []string{"on", "80"}},
+		{"double quotes", `effect select "Northern Lights"`, []string{"effect", "select", "Northern Lights"}},
+		{"single quotes", `effect select 'Northern Lights'`, []string{"effect", "select", "Northern Lights"}},
+		{"quotes within a word", `a"b c"d`, []string{"ab cd"}},
+		{"other quote inside quotes", `rename "Bob's panel"`, []string{"rename", "Bob's panel"}},
+		{"empty quotes", `panel rename ""`, []string{"panel", "rename", ""}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := splitArgs(tt.line)
+			if err != nil {
+				t.Fatalf("splitArgs(%q) returned error: %v", tt.line, err)
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.line, args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSplitArgsUnterminatedQuote(t *testing.T) {
+	for _, line := range []string{`effect select "Forest`, `'`} {
+		_, err := splitArgs(line)
+		if err == nil || !strings.Contains(err.Error(), "unterminated") {
+			t.Errorf("splitArgs(%q) error = %v, want unterminated quote", line, err)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	script, err := parseScript("# wake up\n\non 10\n  \n\t# still a comment\nbrightness fade 100 30\n")
+	if err != nil {
+		t.Fatalf("parseScript returned error: %v", err)
+	}
+	want := []scriptLine{
+		{number: 3, args: []string{"on", "10"}},
+		{number: 6, args: []string{"brightness", "fade", "100", "30"}},
+	}
+	if !slices.EqualFunc(script, want, func(a, b scriptLine) bool {
+		return a.number == b.number && slices.Equal(a.args, b.args)
+	}) {
+		t.Errorf("parseScript = %v, want %v", script, want)
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{"standalone command", "on\npair 10.0.0.2\n", "line 2: pair can't be used in a script"},
+		{"nested run", "run other.txt\n", "line 1: run can't be used in a script"},
+		{"unknown command", "# comment\nbrightnes 50\n", `line 2: unknown command "brightnes" (did you mean "brightness"?)`},
+		{"unterminated quote", `effect select "Forest`, "line 1: unterminated \" quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseScript(tt.script)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseScript error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRunContinuesAfterInvalidArguments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.txt")
+	err := os.WriteFile(path, []byte("brightness 150\ntemp 99999\nbrightness\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The arguments are checked before anything is sent, so the client
+	// doesn't need a Nanoleaf.
+	err = doRunCommand(context.Background(), io.Discard, &nanoleaf.Client{}, []string{"-continue", path})
+	if err == nil {
+		t.Fatal("doRunCommand returned no error")
+	}
+	for _, want := range []string{
+		"line 1: brightness must be an integer 0-100",
+		"line 2: temperature must be an integer 1200-6500",
+		"line 3: invalid arguments",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("doRunCommand error = %q, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestSceneReportsFailingStep(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config = &nanoleaf.MicroleafConfig{
+		Scenes: map[string][]string{"evening": {"on", "brightness 150"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	client := &nanoleaf.Client{Host: strings.TrimPrefix(server.URL, "http://")}
+
+	err := doSceneCommand(context.Background(), io.Discard, client, []string{"evening"})
+	want := "scene evening, step 2 (brightness 150): brightness must be an integer 0-100"
+	if err == nil || err.Error() != want {
+		t.Errorf("doSceneCommand error = %v, want %q", err, want)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name             string
+		s                string
+		red, green, blue int
+		wantErr          bool
+	}{
+		{"long hex", "#ff8000", 255, 128, 0, false},
+		{"long hex without hash", "ff8000", 255, 128, 0, false},
+		{"uppercase hex", "#FF8000", 255, 128, 0, false},
+		{"short hex", "#f80", 255, 136, 0, false},
+		{"named color", "orange", 255, 165, 0, false},
+		{"named color ignores case", "Orange", 255, 165, 0, false},
+		{"short hex without hash", "f80", 0, 0, 0, true},
+		{"word that looks like hex", "bad", 0, 0, 0, true},
+		{"non-hex characters", "#ff80zz", 0, 0, 0, true},
+		{"wrong length", "#ff80", 0, 0, 0, true},
+		{"unknown name", "blurple", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, green, blue, err := parseColor(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseColor(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			}
+			if red != tt.red || green != tt.green || blue != tt.blue {
+				t.Errorf("parseColor(%q) = %d, %d, %d, want %d, %d, %d",
+					tt.s, red, green, blue, tt.red, tt.green, tt.blue)
+			}
+		})
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		name             string
+		s                string
+		red, green, blue int
+		wantErr          bool
+	}{
+		{"black", "#000000", 0, 0, 0, false},
+		{"white", "#ffffff", 255, 255, 255, false},
+		{"mixed case", "#12aBcD", 0x12, 0xab, 0xcd, false},
+		{"short form", "#abc", 0xaa, 0xbb, 0xcc, false},
+		{"short form requires hash", "abc", 0, 0, 0, true},
+		{"empty", "", 0, 0, 0, true},
+		{"too long", "#1234567", 0, 0, 0, true},
+		{"sign is not hex", "#+12345", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, green, blue, err := parseHexColor(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHexColor(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			}
+			if red != tt.red || green != tt.green || blue != tt.blue {
+				t.Errorf("parseHexColor(%q) = %d, %d, %d, want %d, %d, %d",
+					tt.s, red, green, blue, tt.red, tt.green, tt.blue)
+			}
+		})
+	}
+}
+
+func TestParsePanelRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		lo, hi  int
+		wantErr bool
+	}{
+		{"single ID", "8", 8, 8, false},
+		{"range", "1-5", 1, 5, false},
+		{"range of one", "3-3", 3, 3, false},
+		{"largest ID", "65535", 65535, 65535, false},
+		{"reversed range", "5-1", 0, 0, true},
+		{"ID too large", "1-65536", 0, 0, true},
+		{"negative ID", "-1", 0, 0, true},
+		{"open range", "1-", 0, 0, true},
+		{"not a number", "a", 0, 0, true},
+		{"empty", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo, hi, err := parsePanelRange(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePanelRange(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			}
+			if lo != tt.lo || hi != tt.hi {
+				t.Errorf("parsePanelRange(%q) = %d, %d, want %d, %d", tt.s, lo, hi, tt.lo, tt.hi)
+			}
+		})
+	}
+}
+
+func TestConfigDecodeError(t *testing.T) {
+	viperErr := errors.New("viper error")
+	tests := []struct {
+		name     string
+		file     string
+		data     string
+		location string
+	}{
+		{"toml syntax", "config.toml", "[[host_configs]]\npanel_name = \n", "at line 2, column 14"},
+		{"toml type", ".microleafrc", "[[host_configs]]\npanel_name = 1\n", "at line 2, column 1"},
+		{"json syntax", "config.json", "{\n  \"host_configs\": [,]\n}\n", "at line 2, column 20"},
+		{"json type", "config.json", "{\n  \"host_configs\": 1\n}\n", "at line 2, column 19"},
+		{"json truncated", "config.json", "", "at line 1, column 1"},
+		{"yaml", "config.yaml", "host_configs:\n  - panel_name: [\n", "line 2"},
+		{"valid", "config.toml", "[[host_configs]]\npanel_name = \"a\"\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := configDecodeError(path, viperErr)
+			if tt.location == "" {
+				if err != viperErr {
+					t.Errorf("configDecodeError() = %v, want %v", err, viperErr)
+				}
+				return
+			}
+			if !strings.Contains(err.Error(), tt.location) {
+				t.Errorf("configDecodeError() = %q, want it to contain %q", err, tt.location)
+			}
+		})
+	}
+}
+
+func TestConfigDecodeErrorUnreadable(t *testing.T) {
+	viperErr := errors.New("viper error")
+	path := filepath.Join(t.TempDir(), "missing.toml")
+	if err := configDecodeError(path, viperErr); err != viperErr {
+		t.Errorf("configDecodeError() = %v, want %v", err, viperErr)
+	}
+}
+
+func TestLineColumn(t *testing.T) {
+	data := []byte("ab\ncd\n")
+	tests := []struct {
+		offset int64
+		want   string
+	}{
+		{0, "line 1, column 1"},
+		{1, "line 1, column 2"},
+		{3, "line 2, column 1"},
+		{5, "line 2, column 3"},
+		{-1, "line 1, column 1"},
+		{100, "line 3, column 1"},
+	}
+	for _, tt := range tests {
+		if got := lineColumn(data, tt.offset); got != tt.want {
+			t.Errorf("lineColumn(%q, %d) = %q, want %q", data, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"status", "status", 0},
+		{"stauts", "status", 2},
+		{"tggle", "toggle", 1},
+		{"brightnes", "brightness", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want string
+	}{
+		{"transposition", "brigthness", "brightness"},
+		{"missing letter", "tggle", "toggle"},
+		{"extra letter", "statuss", "status"},
+		{"ties go to the first command", "of", "off"},
+		{"exact match", "rgb", "rgb"},
+		{"short command too far", "xyz", ""},
+		{"long command too far", "frobnicate", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestCommand(tt.cmd); got != tt.want {
+				t.Errorf("suggestCommand(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	panelNames := []string{"Desk", "shelf", "Shelf"}
+	groupNames := []string{"Office"}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"Desk", "Desk", false},
+		{"desk", "Desk", false},
+		{"office", "Office", false},
+		{"ALL", "all", false},
+		{"shelf", "shelf", false},
+		{"SHELF", "", true},
+		{"unknown", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveName(tt.name, panelNames, groupNames)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveName(%q) error = %v, want error %t", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectHostConfigs(t *testing.T) {
+	config := &nanoleaf.MicroleafConfig{
+		HostConfigs: []nanoleaf.HostConfig{
+			{PanelName: "Desk"},
+			{PanelName: "shelf"},
+			{PanelName: "Shelf"},
+			{PanelName: "tv"},
+		},
+		Groups: map[string][]string{"Office": {"Desk", "shelf"}},
+	}
+	tests := []struct {
+		name    string
+		names   []string
+		strict  bool
+		want    []string
+		wantErr bool
+	}{
+		{"exact name", []string{"Desk"}, false, []string{"Desk"}, false},
+		{"name in other case", []string{"desk"}, false, []string{"Desk"}, false},
+		{"group in other case", []string{"office"}, false, []string{"Desk", "shelf"}, false},
+		{"all in other case", []string{"All"}, false, []string{"Desk", "shelf", "Shelf", "tv"}, false},
+		{"duplicates dropped", []string{"tv", "all"}, false, []string{"tv", "Desk", "shelf", "Shelf"}, false},
+		{"ambiguous case", []string{"SHELF"}, false, nil, true},
+		{"unknown name", []string{"lamp"}, false, nil, true},
+		{"strict exact name", []string{"Desk"}, true, []string{"Desk"}, false},
+		{"strict name in other case", []string{"desk"}, true, nil, true},
+		{"strict group in other case", []string{"office"}, true, nil, true},
+		{"strict ambiguous case", []string{"Shelf"}, true, []string{"Shelf"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strict := *strictNames
+			*strictNames = tt.strict
+			t.Cleanup(func() { *strictNames = strict })
+
+			selected, err := selectHostConfigs(config, tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectHostConfigs(%q) error = %v, want error %t", tt.names, err, tt.wantErr)
+			}
+			var got []string
+			for _, hostConfig := range selected {
+				got = append(got, hostConfig.PanelName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectHostConfigs(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// panelMetrics holds the gauges exported by serve-metrics, labeled by panel
+// name.
+type panelMetrics struct {
+	up               *prometheus.GaugeVec
+	on               *prometheus.GaugeVec
+	brightness       *prometheus.GaugeVec
+	colorTemperature *prometheus.GaugeVec
+}
+
+func newPanelMetrics(registry prometheus.Registerer) *panelMetrics {
+	newGauge := func(name, help string) *prometheus.GaugeVec {
+		gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "nanoleaf",
+			Name:      name,
+			Help:      help,
+		}, []string{"panel"})
+		registry.MustRegister(gauge)
+		return gauge
+	}
+
+	return &panelMetrics{
+		up:               newGauge("up", "Whether the last poll of the Nanoleaf succeeded."),
+		on:               newGauge("on", "Whether the Nanoleaf is on."),
+		brightness:       newGauge("brightness_percent", "The Nanoleaf's brightness."),
+		colorTemperature: newGauge("color_temperature_kelvin", "The Nanoleaf's color temperature."),
+	}
+}
+
+// update records the state polled from the named panel. If the poll failed,
+// only the up gauge is updated, so the last known values remain.
+func (m *panelMetrics) update(name string, state *nanoleaf.State, err error) {
+	if err != nil {
+		m.up.WithLabelValues(name).Set(0)
+		return
+	}
+	m.up.WithLabelValues(name).Set(1)
+
+	if state.On != nil {
+		on := 0.0
+		if state.On.Value {
+			on = 1
+		}
+		m.on.WithLabelValues(name).Set(on)
+	}
+	if state.Brightness != nil {
+		m.brightness.WithLabelValues(name).Set(float64(state.Brightness.Value))
+	}
+	if state.ColorTemperature != nil {
+		m.colorTemperature.WithLabelValues(name).Set(float64(state.ColorTemperature.Value))
+	}
+}
+
+// doServeMetricsCommand serves Prometheus metrics for every selected panel
+// until interrupted, polling each panel's state every -interval.
+func doServeMetricsCommand(ctx context.Context, clients []*nanoleaf.Client, names []string, args []string) error {
+	fs := flag.NewFlagSet("serve-metrics", flag.ContinueOnError)
+	listen := fs.String("listen", ":9101", "Address to serve metrics on")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage(err, "usage: microleaf [-interval <duration>] serve-metrics [-listen <address>]")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	registry := prometheus.NewRegistry()
+	metrics := newPanelMetrics(registry)
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pollMetrics(ctx, client, names[i], metrics)
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: *listen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.WithoutCancel(ctx))
+	}()
+
+	slog.Info("serving metrics", "address", *listen)
+	err = server.ListenAndServe()
+	stop()
+	wg.Wait()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	return nil
+}
+
+// pollMetrics updates metrics with the panel's state every -interval until
+// ctx is done.
+func pollMetrics(ctx context.Context, client *nanoleaf.Client, name string, metrics *panelMetrics) {
+	ticker := time.NewTicker(*watchInterval)
+	defer ticker.Stop()
+
+	for {
+		state, err := client.GetState(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("failed to get Nanoleaf state", "panel", name, "err", err)
+		}
+		metrics.update(name, state, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
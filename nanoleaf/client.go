@@ -0,0 +1,1678 @@
+package nanoleaf
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ExternalControlPort is the UDP port for Nanoleaf external control.
+const ExternalControlPort = 60222
+
+// DefaultTimeout is the default time allowed for the Nanoleaf to respond to a
+// request.
+const DefaultTimeout = 5 * time.Second
+
+// retryBackoff is the delay before the first retry of a failed request. It
+// doubles with each subsequent retry.
+const retryBackoff = 250 * time.Millisecond
+
+// transport is shared by every Client, so that connections to each Nanoleaf
+// are kept alive and reused across requests, e.g. during animations, and
+// across clients for the same host.
+var transport = newTransport()
+
+// connectTimeoutKey is the context key for a client's ConnectTimeout, which
+// the shared transport's dialer applies to new connections.
+type connectTimeoutKey struct{}
+
+// newTransport returns an HTTP transport tuned for a handful of Nanoleafs on
+// the local network.
+func newTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+			d := *dialer
+			d.Timeout = timeout
+			return d.DialContext(ctx, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	t.MaxIdleConns = 32
+	t.MaxIdleConnsPerHost = 4
+	t.IdleConnTimeout = 30 * time.Second
+	// The Nanoleaf only speaks plain HTTP/1.1.
+	t.ForceAttemptHTTP2 = false
+	return t
+}
+
+// ErrNotPairing is returned by Pair when the Nanoleaf is not in pairing mode.
+var ErrNotPairing = errors.New("nanoleaf is not in pairing mode")
+
+// ErrLoopUnsupported is returned by SetEffectLoop for effects without a loop
+// setting, such as plugin effects.
+var ErrLoopUnsupported = errors.New("effect doesn't support looping")
+
+// ErrUnauthorized is matched, using errors.Is, by the APIError returned when
+// the Nanoleaf rejects the access token, e.g. because it was revoked by a
+// factory reset. A new token can be obtained with Pair.
+var ErrUnauthorized = errors.New("nanoleaf rejected the access token")
+
+// ErrRebootUnsupported is matched, using errors.Is, by the error Reboot
+// returns when the Nanoleaf's firmware doesn't support rebooting.
+var ErrRebootUnsupported = errors.New("firmware doesn't support rebooting")
+
+// Client is a Nanoleaf REST API client.
+type Client struct {
+	Host  string
+	Token string
+
+	// Logger receives request and response logs. If nil, nothing is
+	// logged.
+	Logger *slog.Logger
+
+	// Timeout is the time allowed for the Nanoleaf to respond to a request.
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// ConnectTimeout is the time allowed to connect to the Nanoleaf,
+	// including resolving its host, within Timeout. If zero, only Timeout
+	// applies.
+	ConnectTimeout time.Duration
+
+	// Retries is the number of times to retry a failed idempotent request:
+	// GET requests, and PUT requests other than relative state changes and
+	// effect additions and deletions.
+	Retries int
+
+	// DryRun prints requests that would change the Nanoleaf to Output
+	// instead of sending them. Read-only GET requests are still sent.
+	DryRun bool
+
+	// Output receives the requests printed by DryRun. If nil, they're
+	// discarded.
+	Output io.Writer
+
+	// ValidateTemperature makes SetColorTemperature check temperatures
+	// against the range the Nanoleaf reports, since it silently ignores
+	// temperatures it doesn't support.
+	ValidateTemperature bool
+
+	// ValidateBrightness makes SetBrightness and TurnOnWithBrightness check
+	// brightnesses against the range the Nanoleaf reports.
+	ValidateBrightness bool
+
+	client http.Client
+
+	// temperatureRange caches the range returned by ColorTemperatureRange.
+	temperatureRange *[2]int
+
+	// brightnessRange caches the range returned by BrightnessRange.
+	brightnessRange *[2]int
+
+	// streamAddr is the address StreamPanelColors sends frames to, set
+	// once it has started external control, and stream is the UDP socket
+	// it sends them over, which isn't opened in DryRun.
+	streamAddr *net.UDPAddr
+	stream     *net.UDPConn
+}
+
+// httpClient returns the HTTP client to send requests with, which uses the
+// shared transport unless the client was given its own.
+func (c *Client) httpClient() *http.Client {
+	client := c.client
+	if client.Transport == nil {
+		client.Transport = transport
+	}
+	client.Timeout = c.Timeout
+	if client.Timeout == 0 {
+		client.Timeout = DefaultTimeout
+	}
+	return &client
+}
+
+// logger returns the logger to log requests with.
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return c.Logger
+}
+
+// output returns the writer to print dry-run requests to.
+func (c *Client) output() io.Writer {
+	if c.Output == nil {
+		return io.Discard
+	}
+	return c.Output
+}
+
+// withConnectTimeout returns ctx carrying the client's ConnectTimeout, if
+// set, for the shared transport's dialer.
+func (c *Client) withConnectTimeout(ctx context.Context) context.Context {
+	if c.ConnectTimeout == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, connectTimeoutKey{}, c.ConnectTimeout)
+}
+
+// checkConnectTimeout replaces an error from failing to connect within
+// ConnectTimeout with a clearer message.
+func (c *Client) checkConnectTimeout(err error) error {
+	var opErr *net.OpError
+	if c.ConnectTimeout != 0 && errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return fmt.Errorf("could not connect to panel within %s", c.ConnectTimeout)
+	}
+	return err
+}
+
+// checkTimeout replaces timeout errors from client with a clearer message.
+func checkTimeout(client *http.Client, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("panel did not respond within %s", client.Timeout)
+	}
+	return err
+}
+
+// Get performs a GET request. A non-2xx response is returned as an
+// *APIError.
+func (c *Client) Get(ctx context.Context, path string) (string, error) {
+	return c.do(ctx, http.MethodGet, path, nil, true)
+}
+
+// Put performs a PUT request, which is retried on failure, so must be
+// idempotent. A non-2xx response is returned as an *APIError.
+func (c *Client) Put(ctx context.Context, path string, body []byte) (string, error) {
+	return c.do(ctx, http.MethodPut, path, body, true)
+}
+
+// PutOnce performs a PUT request without retrying it, for requests that
+// aren't idempotent, such as relative state changes. A non-2xx response is
+// returned as an *APIError.
+func (c *Client) PutOnce(ctx context.Context, path string, body []byte) (string, error) {
+	return c.do(ctx, http.MethodPut, path, body, false)
+}
+
+// Post performs a POST request. A non-2xx response is returned as an
+// *APIError.
+func (c *Client) Post(ctx context.Context, path string, body []byte) (string, error) {
+	return c.do(ctx, http.MethodPost, path, body, false)
+}
+
+// Delete performs a DELETE request. A non-2xx response is returned as an
+// *APIError.
+func (c *Client) Delete(ctx context.Context, path string) (string, error) {
+	return c.do(ctx, http.MethodDelete, path, nil, false)
+}
+
+// do performs a request, returning the response body, or an *APIError if
+// the response status isn't 2xx.
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, idempotent bool) (string, error) {
+	status, responseBody, err := c.request(ctx, method, path, body, idempotent)
+	if err != nil {
+		return "", err
+	}
+	return responseBody, checkStatus(status, responseBody)
+}
+
+// request performs a request with the given method, returning the response
+// status code along with the response body. If idempotent, requests that
+// fail with a network error or a 5xx status are retried up to c.Retries
+// times, backing off exponentially between attempts. Requests that aren't
+// idempotent are sent once, as a failed attempt may still have been applied.
+func (c *Client) request(ctx context.Context, method string, path string, body []byte, idempotent bool) (int, string, error) {
+	attempts := 1
+	if idempotent {
+		attempts += c.Retries
+	}
+
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		status, responseBody, err := c.send(ctx, method, path, body)
+		if (err == nil && status < 500) || attempt >= attempts {
+			return status, responseBody, err
+		}
+
+		c.logger().Info("retrying request",
+			"method", method, "path", path,
+			"backoff", backoff, "attempt", attempt+1, "attempts", attempts)
+		if !sleep(ctx, backoff) {
+			return 0, "", ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// send performs a single request with the given method, returning the
+// response status code along with the response body.
+func (c *Client) send(ctx context.Context, method string, path string, body []byte) (int, string, error) {
+	endpoint := c.Endpoint(path)
+	log := c.logger()
+	log.Info("request", "method", method, "path", path)
+	if body != nil {
+		log.Debug("request", "method", method, "url", c.maskedEndpoint(path), "body", string(body))
+	} else {
+		log.Debug("request", "method", method, "url", c.maskedEndpoint(path))
+	}
+
+	if c.DryRun && method != http.MethodGet {
+		out := c.output()
+		fmt.Fprintln(out, method, c.maskedEndpoint(path))
+		if body != nil {
+			fmt.Fprintln(out, string(body))
+		}
+		fmt.Fprintln(out)
+		return http.StatusNoContent, "", nil
+	}
+
+	req, err := http.NewRequestWithContext(c.withConnectTimeout(ctx), method, endpoint, nil)
+	if err != nil {
+		return 0, "", c.maskURLError(err, path)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	client := c.httpClient()
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, "", checkTimeout(client, c.checkConnectTimeout(c.maskURLError(err, path)))
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, "", checkTimeout(client, c.maskURLError(err, path))
+	}
+
+	log.Info("response", "method", method, "path", path, "status", res.StatusCode)
+	if method == http.MethodGet {
+		log.Debug("response body", "method", method, "path", path, "body", string(responseBody))
+	}
+	return res.StatusCode, string(responseBody), nil
+}
+
+// Pair requests a new access token from the Nanoleaf at host. The Nanoleaf
+// must be in pairing mode, which is entered by holding the power button for
+// 5-7 seconds. The Nanoleaf must respond within timeout.
+func Pair(ctx context.Context, host string, timeout time.Duration) (string, error) {
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	url := fmt.Sprintf("http://%s/api/v1/new", host)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", checkTimeout(client, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return "", ErrNotPairing
+	default:
+		body, _ := io.ReadAll(res.Body)
+		return "", &APIError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var body struct {
+		AuthToken string `json:"auth_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	return body.AuthToken, nil
+}
+
+// Endpoint returns the full URL for an API endpoint.
+func (c *Client) Endpoint(path string) string {
+	return fmt.Sprintf("http://%s/api/v1/%s/%s", c.Host, c.Token, path)
+}
+
+// maskedEndpoint is like Endpoint, but with the access token masked so that
+// it can be safely logged.
+func (c *Client) maskedEndpoint(path string) string {
+	return fmt.Sprintf("http://%s/api/v1/%s/%s", c.Host, maskToken(c.Token), path)
+}
+
+// maskURLError replaces the URL in a *url.Error from a request to path with
+// the masked endpoint, since the URL includes the access token.
+func (c *Client) maskURLError(err error, path string) error {
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	masked := *urlErr
+	masked.URL = c.maskedEndpoint(path)
+	return &masked
+}
+
+// maskToken masks all but the last 4 characters of an access token.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", len(token)-4) + token[len(token)-4:]
+}
+
+// Effects represents the Nanoleaf panel effects state.
+type Effects struct {
+	Selected string   `json:"select"`
+	List     []string `json:"effectsList"`
+}
+
+// Rhythm represents the Nanoleaf rhythm state.
+type Rhythm struct {
+	Connected       bool   `json:"rhythmConnected"`
+	Active          bool   `json:"rhythmActive"`
+	ID              int    `json:"rhythmId"`
+	HardwareVersion string `json:"hardwareVersion"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	AuxAvailable    bool   `json:"auxAvailable"`
+	Mode            int    `json:"rhythmMode"`
+	Position        struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+		O float64 `json:"o"`
+	} `json:"rhythmPos"`
+}
+
+// PanelPosition represents the position of a single Nanoleaf panel.
+type PanelPosition struct {
+	PanelID   int `json:"panelId"`
+	X         int `json:"x"`
+	Y         int `json:"y"`
+	O         int `json:"o"`
+	ShapeType int `json:"shapeType"`
+}
+
+// Layout represents the arrangement of the Nanoleaf's panels.
+type Layout struct {
+	NumPanels    int             `json:"numPanels"`
+	SideLength   int             `json:"sideLength"`
+	PositionData []PanelPosition `json:"positionData"`
+}
+
+// PanelLayout represents the Nanoleaf panel layout.
+type PanelLayout struct {
+	Layout            Layout            `json:"layout"`
+	GlobalOrientation GlobalOrientation `json:"globalOrientation"`
+}
+
+// GlobalOrientation is the rotation, in degrees, of the whole panel layout.
+type GlobalOrientation struct {
+	Value int `json:"value"`
+	Max   int `json:"max"`
+	Min   int `json:"min"`
+}
+
+// PanelInfo represents the Nanoleaf panel info response.
+type PanelInfo struct {
+	Name            string      `json:"name"`
+	SerialNo        string      `json:"serialNo"`
+	Manufacturer    string      `json:"manufacturer"`
+	FirmwareVersion string      `json:"firmwareVersion"`
+	Model           string      `json:"model"`
+	State           State       `json:"state"`
+	Effects         Effects     `json:"effects"`
+	PanelLayout     PanelLayout `json:"panelLayout"`
+	Rhythm          Rhythm      `json:"rhythm"`
+}
+
+// GetPanelInfo returns the Nanoleaf panel info.
+func (c *Client) GetPanelInfo(ctx context.Context) (*PanelInfo, error) {
+	body, err := c.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var panelInfo PanelInfo
+	err = json.Unmarshal([]byte(body), &panelInfo)
+	return &panelInfo, err
+}
+
+// GetState returns the Nanoleaf's current state.
+func (c *Client) GetState(ctx context.Context) (*State, error) {
+	body, err := c.Get(ctx, "state")
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	err = json.Unmarshal([]byte(body), &state)
+	return &state, err
+}
+
+// GetLayout returns the arrangement of the Nanoleaf's panels.
+func (c *Client) GetLayout(ctx context.Context) (*Layout, error) {
+	body, err := c.Get(ctx, "panelLayout/layout")
+	if err != nil {
+		return nil, err
+	}
+
+	var layout Layout
+	err = json.Unmarshal([]byte(body), &layout)
+	return &layout, err
+}
+
+// GetGlobalOrientation returns the rotation of the Nanoleaf's panel layout,
+// and the range it may be set within.
+func (c *Client) GetGlobalOrientation(ctx context.Context) (*GlobalOrientation, error) {
+	body, err := c.Get(ctx, "panelLayout/globalOrientation")
+	if err != nil {
+		return nil, err
+	}
+
+	var orientation GlobalOrientation
+	err = json.Unmarshal([]byte(body), &orientation)
+	return &orientation, err
+}
+
+// SetGlobalOrientation rotates the Nanoleaf's panel layout to degrees, which
+// changes the direction effects flow in.
+func (c *Client) SetGlobalOrientation(ctx context.Context, degrees int) error {
+	bytes, err := json.Marshal(orientationRequest{
+		GlobalOrientation: valueProperty{Value: degrees},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "panelLayout", bytes)
+	return err
+}
+
+// GetSelectedEffect returns the name of the currently selected effect, which
+// is much cheaper than fetching the full panel info.
+func (c *Client) GetSelectedEffect(ctx context.Context) (string, error) {
+	body, err := c.Get(ctx, "effects/select")
+	if err != nil {
+		return "", err
+	}
+
+	var name string
+	err = json.Unmarshal([]byte(body), &name)
+	return name, err
+}
+
+// ListEffects returns an array of effect names.
+func (c *Client) ListEffects(ctx context.Context) ([]string, error) {
+	body, err := c.Get(ctx, "effects/effectsList")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	err = json.Unmarshal([]byte(body), &list)
+	return list, err
+}
+
+// Off turns off Nanoleaf.
+func (c *Client) Off(ctx context.Context) error {
+	state := State{
+		On: &OnProperty{false},
+	}
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// On turns on Nanoleaf.
+func (c *Client) On(ctx context.Context) error {
+	state := State{
+		On: &OnProperty{true},
+	}
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// TurnOnWithBrightness turns on Nanoleaf at the given brightness in a single
+// request, avoiding a flash at the previous brightness. If ValidateBrightness
+// is set, brightnesses outside BrightnessRange are rejected.
+func (c *Client) TurnOnWithBrightness(ctx context.Context, level int) error {
+	if err := c.checkBrightness(ctx, level); err != nil {
+		return err
+	}
+
+	state := State{
+		On:         &OnProperty{true},
+		Brightness: &BrightnessProperty{Value: level},
+	}
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// Toggle flips the Nanoleaf's current on/off state.
+func (c *Client) Toggle(ctx context.Context) error {
+	panelInfo, err := c.GetPanelInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if panelInfo.State.On != nil && panelInfo.State.On.Value {
+		return c.Off(ctx)
+	}
+	return c.On(ctx)
+}
+
+// Identify makes the Nanoleaf's panels flash briefly.
+func (c *Client) Identify(ctx context.Context) error {
+	status, body, err := c.request(ctx, http.MethodPut, "identify", nil, true)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNoContent {
+		return &APIError{StatusCode: status, Body: strings.TrimSpace(body)}
+	}
+	return nil
+}
+
+// Reboot restarts the Nanoleaf's controller. Rebooting isn't part of the
+// documented API, so only some firmware versions support it; others reject
+// the request with an *APIError, wrapped to also match ErrRebootUnsupported.
+func (c *Client) Reboot(ctx context.Context) error {
+	// The controller may drop the connection as it restarts, so a failed
+	// attempt mustn't be retried.
+	_, err := c.PutOnce(ctx, "reboot", nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("%w: %w", ErrRebootUnsupported, err)
+	}
+	return err
+}
+
+// SetName renames the Nanoleaf.
+func (c *Client) SetName(ctx context.Context, name string) error {
+	req := nameRequest{
+		Name: name,
+	}
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// checkStatus returns an *APIError describing the response if status isn't
+// a 2xx status code.
+func checkStatus(status int, body string) error {
+	if status < 200 || status > 299 {
+		return &APIError{StatusCode: status, Body: strings.TrimSpace(body)}
+	}
+	return nil
+}
+
+// maxErrorBodyLength is the longest response body included in an APIError's
+// message.
+const maxErrorBodyLength = 200
+
+// APIError is returned when the Nanoleaf responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("unexpected response status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.StatusCode == http.StatusUnauthorized {
+		msg = fmt.Sprintf("%s (%d %s)", ErrUnauthorized, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Body == "" {
+		return msg
+	}
+	body := e.Body
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength] + "..."
+	}
+	return msg + ": " + body
+}
+
+// Is reports whether the error is ErrUnauthorized, for 401 responses.
+func (e *APIError) Is(target error) bool {
+	return target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized
+}
+
+// Snapshot represents a saved Nanoleaf state that can be restored later.
+type Snapshot struct {
+	On               bool   `json:"on"`
+	Brightness       int    `json:"brightness"`
+	ColorMode        string `json:"colorMode"`
+	Hue              int    `json:"hue"`
+	Saturation       int    `json:"saturation"`
+	ColorTemperature int    `json:"colorTemperature"`
+	Effect           string `json:"effect,omitempty"`
+}
+
+// Snapshot captures the Nanoleaf's current state.
+func (c *Client) Snapshot(ctx context.Context) (*Snapshot, error) {
+	panelInfo, err := c.GetPanelInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := panelInfo.State
+	snapshot := Snapshot{
+		ColorMode: state.ColorMode,
+		Effect:    panelInfo.Effects.Selected,
+	}
+	if state.On != nil {
+		snapshot.On = state.On.Value
+	}
+	if state.Brightness != nil {
+		snapshot.Brightness = state.Brightness.Value
+	}
+	if state.Hue != nil {
+		snapshot.Hue = state.Hue.Value
+	}
+	if state.Saturation != nil {
+		snapshot.Saturation = state.Saturation.Value
+	}
+	if state.ColorTemperature != nil {
+		snapshot.ColorTemperature = state.ColorTemperature.Value
+	}
+	return &snapshot, nil
+}
+
+// Restore reapplies a previously captured state to the Nanoleaf.
+func (c *Client) Restore(ctx context.Context, snapshot *Snapshot) error {
+	var err error
+	switch snapshot.ColorMode {
+	case "hs":
+		err = c.SetHSV(ctx, snapshot.Hue, snapshot.Saturation, snapshot.Brightness, 0)
+	case "ct":
+		err = c.SetColorTemperature(ctx, snapshot.ColorTemperature, 0)
+		if err == nil {
+			err = c.SetBrightness(ctx, snapshot.Brightness, 0)
+		}
+	default:
+		if snapshot.Effect != "" {
+			err = c.SelectEffect(ctx, snapshot.Effect)
+		}
+		if err == nil {
+			err = c.SetBrightness(ctx, snapshot.Brightness, 0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Setting a color turns the Nanoleaf on, so restore the power state
+	// last.
+	return c.setPower(ctx, snapshot.On)
+}
+
+// Flash blinks the Nanoleaf count times, switching its power for interval
+// and back again, then restores its prior state. It also stops and restores
+// the prior state if ctx is cancelled or switching the power fails.
+func (c *Client) Flash(ctx context.Context, count int, interval time.Duration) (err error) {
+	snapshot, err := c.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Restore even if ctx was cancelled or a switch failed part way
+	// through, reporting the first error.
+	defer func() {
+		restoreErr := c.Restore(context.WithoutCancel(ctx), snapshot)
+		if err == nil {
+			err = restoreErr
+		}
+	}()
+
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		err = c.setPower(ctx, !snapshot.On)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if !sleep(ctx, interval) {
+			break
+		}
+
+		err = c.setPower(ctx, snapshot.On)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		sleep(ctx, interval)
+	}
+	return nil
+}
+
+// blinkCount and blinkInterval set how BlinkPanel flashes a panel.
+const (
+	blinkCount    = 3
+	blinkInterval = 400 * time.Millisecond
+)
+
+// BlinkPanel identifies a single panel by flashing it white a few times over
+// external control, then restores the Nanoleaf's prior state. It also stops
+// and restores the prior state if ctx is cancelled.
+func (c *Client) BlinkPanel(ctx context.Context, id uint16) error {
+	snapshot, err := c.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// The panel can't be seen while the Nanoleaf is off.
+	if !snapshot.On {
+		err = c.setPower(ctx, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < blinkCount && ctx.Err() == nil; i++ {
+		for _, level := range []uint8{255, 0} {
+			err = c.StreamPanelColors(ctx, []SetPanelColor{{PanelID: id, Red: level, Green: level, Blue: level}})
+			if err != nil && ctx.Err() == nil {
+				return err
+			}
+			if !sleep(ctx, blinkInterval) {
+				break
+			}
+		}
+	}
+
+	// Restore even if ctx was cancelled part way through.
+	return c.Restore(context.WithoutCancel(ctx), snapshot)
+}
+
+// Pulse ramps the Nanoleaf's brightness down and back up cycles times, each
+// cycle taking roughly period, then restores its original brightness. It
+// also stops and restores the brightness if ctx is cancelled.
+func (c *Client) Pulse(ctx context.Context, cycles int, period time.Duration) error {
+	state, err := c.GetState(ctx)
+	if err != nil {
+		return err
+	}
+	if state.Brightness == nil {
+		return errors.New("nanoleaf did not report its brightness")
+	}
+	original := state.Brightness.Value
+	low := original / 4
+
+	// Transition durations are in whole seconds.
+	half := max(1, int(math.Round(period.Seconds()/2)))
+	step := time.Duration(half) * time.Second
+
+	for i := 0; i < cycles && ctx.Err() == nil; i++ {
+		err = c.SetBrightness(ctx, low, half)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if !sleep(ctx, step) {
+			break
+		}
+
+		err = c.SetBrightness(ctx, original, half)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		sleep(ctx, step)
+	}
+
+	// Restore even if ctx was cancelled part way through.
+	return c.SetBrightness(context.WithoutCancel(ctx), original, 0)
+}
+
+// maxRampSteps is the most steps Ramp divides a ramp into.
+const maxRampSteps = 100
+
+// LightLevel is a combined brightness and color temperature.
+type LightLevel struct {
+	Brightness       int
+	ColorTemperature int
+}
+
+// Ramp turns the Nanoleaf on and gradually changes its brightness and color
+// temperature from one level to another over duration, in steps of at least
+// a second. If ctx is cancelled, the Nanoleaf is left at the current
+// interpolated level.
+func (c *Client) Ramp(ctx context.Context, from, to LightLevel, duration time.Duration) error {
+	stepSeconds := max(1, int(duration.Seconds()/maxRampSteps))
+	steps := max(1, int(duration.Seconds())/stepSeconds)
+	step := time.Duration(stepSeconds) * time.Second
+
+	err := c.setLightLevel(ctx, from, 0)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= steps; i++ {
+		start := time.Now()
+		err = c.setLightLevel(ctx, interpolateLevel(from, to, float64(i)/float64(steps)), stepSeconds)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if !sleep(ctx, step) {
+			// Stop the in-flight transition where it is.
+			elapsed := min(1, float64(time.Since(start))/float64(step))
+			t := (float64(i-1) + elapsed) / float64(steps)
+			return c.setLightLevel(context.WithoutCancel(ctx), interpolateLevel(from, to, t), 0)
+		}
+	}
+	return nil
+}
+
+// setLightLevel turns the Nanoleaf on and sets its brightness and color
+// temperature, transitioning over duration seconds.
+func (c *Client) setLightLevel(ctx context.Context, level LightLevel, duration int) error {
+	state := State{
+		On:               &OnProperty{true},
+		Brightness:       &BrightnessProperty{Value: level.Brightness, Duration: duration},
+		ColorTemperature: &ColorTemperatureProperty{Value: level.ColorTemperature, Duration: duration},
+	}
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// interpolateLevel returns the level a fraction t of the way from a to b.
+func interpolateLevel(a, b LightLevel, t float64) LightLevel {
+	return LightLevel{
+		Brightness:       a.Brightness + int(math.Round(float64(b.Brightness-a.Brightness)*t)),
+		ColorTemperature: a.ColorTemperature + int(math.Round(float64(b.ColorTemperature-a.ColorTemperature)*t)),
+	}
+}
+
+// sleep pauses for d, returning false if ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// setPower turns the Nanoleaf on or off.
+func (c *Client) setPower(ctx context.Context, on bool) error {
+	if on {
+		return c.On(ctx)
+	}
+	return c.Off(ctx)
+}
+
+// SelectEffect activates the specified effect.
+func (c *Client) SelectEffect(ctx context.Context, name string) error {
+	req := effectsSelectRequest{
+		Select: name,
+	}
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "effects/select", bytes)
+	return err
+}
+
+// DeleteEffect deletes the named effect from the Nanoleaf.
+func (c *Client) DeleteEffect(ctx context.Context, name string) error {
+	req := effectsWriteRequest{
+		Write: effectCommand{
+			Command:  "delete",
+			AnimName: name,
+		},
+	}
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	status, body, err := c.request(ctx, http.MethodPut, "effects", bytes, false)
+	if err != nil {
+		return err
+	}
+	return checkStatus(status, body)
+}
+
+// ExportEffect returns the full JSON definition of the named effect.
+func (c *Client) ExportEffect(ctx context.Context, name string) (json.RawMessage, error) {
+	req := effectsWriteRequest{
+		Write: effectCommand{
+			Command:  "request",
+			AnimName: name,
+		},
+	}
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.request(ctx, http.MethodPut, "effects", bytes, true)
+	if err != nil {
+		return nil, err
+	}
+	err = checkStatus(status, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("invalid effect definition: %s", body)
+	}
+	return json.RawMessage(body), nil
+}
+
+// EffectInfo represents the definition of a Nanoleaf effect.
+type EffectInfo struct {
+	Name          string         `json:"animName"`
+	Type          string         `json:"animType"`
+	Version       string         `json:"version,omitempty"`
+	ColorType     string         `json:"colorType,omitempty"`
+	Palette       []PaletteColor `json:"palette,omitempty"`
+	PluginType    string         `json:"pluginType,omitempty"`
+	PluginUUID    string         `json:"pluginUuid,omitempty"`
+	PluginOptions []PluginOption `json:"pluginOptions,omitempty"`
+	AnimData      string         `json:"animData,omitempty"`
+	Loop          bool           `json:"loop,omitempty"`
+}
+
+// PaletteColor represents a color in an effect's palette.
+type PaletteColor struct {
+	Hue         int     `json:"hue"`
+	Saturation  int     `json:"saturation"`
+	Brightness  int     `json:"brightness"`
+	Probability float64 `json:"probability,omitempty"`
+}
+
+// PluginOption represents a named plugin parameter of an effect.
+type PluginOption struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// GetEffectInfo returns the definition of the named effect.
+func (c *Client) GetEffectInfo(ctx context.Context, name string) (*EffectInfo, error) {
+	effect, err := c.ExportEffect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var effectInfo EffectInfo
+	err = json.Unmarshal(effect, &effectInfo)
+	return &effectInfo, err
+}
+
+// GetEffectsList returns the definitions of every installed effect, including
+// their types and palettes where the firmware provides them.
+func (c *Client) GetEffectsList(ctx context.Context) ([]EffectInfo, error) {
+	bytes, err := json.Marshal(effectsWriteRequest{
+		Write: effectCommand{Command: "requestAll"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.request(ctx, http.MethodPut, "effects", bytes, true)
+	if err != nil {
+		return nil, err
+	}
+	err = checkStatus(status, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Animations []EffectInfo `json:"animations"`
+	}
+	err = json.Unmarshal([]byte(body), &res)
+	return res.Animations, err
+}
+
+// Plugin represents an effect plugin installed on the Nanoleaf.
+type Plugin struct {
+	UUID        string `json:"uuid"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// ListPlugins returns the effect plugins installed on the Nanoleaf.
+func (c *Client) ListPlugins(ctx context.Context) ([]Plugin, error) {
+	bytes, err := json.Marshal(effectsWriteRequest{
+		Write: effectCommand{Command: "requestPlugins"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.request(ctx, http.MethodPut, "effects", bytes, true)
+	if err != nil {
+		return nil, err
+	}
+	err = checkStatus(status, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Plugins []Plugin `json:"plugins"`
+	}
+	err = json.Unmarshal([]byte(body), &res)
+	return res.Plugins, err
+}
+
+// CreatePluginEffect adds a color effect named name, animated by the plugin
+// with the given UUID. An existing effect with the same name is replaced.
+func (c *Client) CreatePluginEffect(ctx context.Context, name string, pluginUUID string, palette []PaletteColor, options []PluginOption) error {
+	effect := EffectInfo{
+		Name:          name,
+		Type:          "plugin",
+		Version:       "2.0",
+		ColorType:     "HSB",
+		Palette:       palette,
+		PluginType:    "color",
+		PluginUUID:    pluginUUID,
+		PluginOptions: options,
+	}
+	bytes, err := json.Marshal(effect)
+	if err != nil {
+		return err
+	}
+	return c.ImportEffect(ctx, bytes)
+}
+
+// ImportEffect adds an effect from its JSON definition, as returned by
+// ExportEffect. An existing effect with the same name is replaced.
+func (c *Client) ImportEffect(ctx context.Context, effect json.RawMessage) error {
+	var write map[string]json.RawMessage
+	err := json.Unmarshal(effect, &write)
+	if err != nil {
+		return err
+	}
+	write["command"] = json.RawMessage(`"add"`)
+
+	bytes, err := json.Marshal(map[string]any{"write": write})
+	if err != nil {
+		return err
+	}
+
+	status, body, err := c.request(ctx, http.MethodPut, "effects", bytes, false)
+	if err != nil {
+		return err
+	}
+	return checkStatus(status, body)
+}
+
+// SetEffectLoop sets whether the named effect loops or plays once, by adding
+// its definition back with the loop setting changed. If the definition has
+// no loop setting, ErrLoopUnsupported is returned.
+func (c *Client) SetEffectLoop(ctx context.Context, name string, loop bool) error {
+	effect, err := c.ExportEffect(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var definition map[string]json.RawMessage
+	err = json.Unmarshal(effect, &definition)
+	if err != nil {
+		return err
+	}
+	if _, ok := definition["loop"]; !ok {
+		return ErrLoopUnsupported
+	}
+	definition["loop"], err = json.Marshal(loop)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	return c.ImportEffect(ctx, bytes)
+}
+
+// SetBrightness sets the Nanoleaf's brightness, transitioning over duration
+// seconds. If ValidateBrightness is set, brightnesses outside BrightnessRange
+// are rejected.
+func (c *Client) SetBrightness(ctx context.Context, brightness int, duration int) error {
+	if err := c.checkBrightness(ctx, brightness); err != nil {
+		return err
+	}
+
+	state := State{
+		Brightness: &BrightnessProperty{Value: brightness, Duration: duration},
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// checkBrightness returns an error if ValidateBrightness is set and
+// brightness is outside BrightnessRange.
+func (c *Client) checkBrightness(ctx context.Context, brightness int) error {
+	if !c.ValidateBrightness {
+		return nil
+	}
+	lo, hi, err := c.BrightnessRange(ctx)
+	if err != nil {
+		return err
+	}
+	if brightness < lo || brightness > hi {
+		return fmt.Errorf("brightness %d is outside the supported range %d-%d", brightness, lo, hi)
+	}
+	return nil
+}
+
+// BrightnessRange returns the minimum and maximum brightness the Nanoleaf
+// reports supporting. The range is fetched once and cached for the lifetime
+// of the client. If the Nanoleaf doesn't report a range, 0-100 is returned.
+func (c *Client) BrightnessRange(ctx context.Context) (lo, hi int, err error) {
+	if c.brightnessRange != nil {
+		return c.brightnessRange[0], c.brightnessRange[1], nil
+	}
+
+	state, err := c.GetState(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lo, hi = 0, 100
+	if b := state.Brightness; b != nil && b.Min != nil && b.Max != nil {
+		lo, hi = *b.Min, *b.Max
+	}
+	c.brightnessRange = &[2]int{lo, hi}
+	return lo, hi, nil
+}
+
+// AdjustBrightness changes the Nanoleaf's brightness by delta.
+func (c *Client) AdjustBrightness(ctx context.Context, delta int) error {
+	req := stateIncrementRequest{
+		Brightness: &incrementProperty{Increment: delta},
+	}
+
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PutOnce(ctx, "state", bytes)
+	return err
+}
+
+// SetHue sets the Nanoleaf's hue, leaving its saturation and brightness
+// unchanged, transitioning over duration seconds.
+func (c *Client) SetHue(ctx context.Context, hue int, duration int) error {
+	state := State{
+		Hue: &HueProperty{Value: hue, Duration: duration},
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// AdjustHue changes the Nanoleaf's hue by delta.
+func (c *Client) AdjustHue(ctx context.Context, delta int) error {
+	req := stateIncrementRequest{
+		Hue: &incrementProperty{Increment: delta},
+	}
+
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PutOnce(ctx, "state", bytes)
+	return err
+}
+
+// SetSaturation sets the Nanoleaf's saturation, leaving its hue and
+// brightness unchanged, transitioning over duration seconds.
+func (c *Client) SetSaturation(ctx context.Context, sat int, duration int) error {
+	state := State{
+		Saturation: &SaturationProperty{Value: sat, Duration: duration},
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// AdjustSaturation changes the Nanoleaf's saturation by delta.
+func (c *Client) AdjustSaturation(ctx context.Context, delta int) error {
+	req := stateIncrementRequest{
+		Saturation: &incrementProperty{Increment: delta},
+	}
+
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PutOnce(ctx, "state", bytes)
+	return err
+}
+
+// SetColorTemperature sets the Nanoleaf's color temperature, transitioning
+// over duration seconds. If ValidateTemperature is set, temperatures outside
+// ColorTemperatureRange are rejected.
+func (c *Client) SetColorTemperature(ctx context.Context, temperature int, duration int) error {
+	if c.ValidateTemperature {
+		lo, hi, err := c.ColorTemperatureRange(ctx)
+		if err != nil {
+			return err
+		}
+		if temperature < lo || temperature > hi {
+			return fmt.Errorf("color temperature %dK is outside the supported range %d-%dK", temperature, lo, hi)
+		}
+	}
+
+	state := State{
+		ColorTemperature: &ColorTemperatureProperty{Value: temperature, Duration: duration},
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// SetColorMode switches the Nanoleaf to a color mode, "hs", "ct", or
+// "effect", without changing its color. The colorMode state is read-only, so
+// the mode is switched by reapplying the current hue and saturation, the
+// current color temperature, or the selected effect. Switching to "effect"
+// fails if no installed effect is selected, e.g. after setting a solid color.
+func (c *Client) SetColorMode(ctx context.Context, mode string) error {
+	if mode == "effect" {
+		name, err := c.GetSelectedEffect(ctx)
+		if err != nil {
+			return err
+		}
+		// The firmware reports solid colors as "*Solid*".
+		if name == "" || strings.HasPrefix(name, "*") {
+			return fmt.Errorf("no effect is selected to switch to (selected: %q)", name)
+		}
+		return c.SelectEffect(ctx, name)
+	}
+
+	current, err := c.GetState(ctx)
+	if err != nil {
+		return err
+	}
+
+	var state State
+	switch mode {
+	case "hs":
+		if current.Hue == nil || current.Saturation == nil {
+			return errors.New("nanoleaf didn't report its hue and saturation")
+		}
+		state.Hue = &HueProperty{Value: current.Hue.Value}
+		state.Saturation = &SaturationProperty{Value: current.Saturation.Value}
+	case "ct":
+		if current.ColorTemperature == nil {
+			return errors.New("nanoleaf didn't report its color temperature")
+		}
+		state.ColorTemperature = &ColorTemperatureProperty{Value: current.ColorTemperature.Value}
+	default:
+		return fmt.Errorf("invalid color mode %q: expected hs, ct, or effect", mode)
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// AdjustColorTemperature changes the Nanoleaf's color temperature by delta
+// Kelvin. The Nanoleaf keeps the result within its supported range.
+func (c *Client) AdjustColorTemperature(ctx context.Context, delta int) error {
+	req := stateIncrementRequest{
+		ColorTemperature: &incrementProperty{Increment: delta},
+	}
+
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PutOnce(ctx, "state", bytes)
+	return err
+}
+
+// ColorTemperatureRange returns the minimum and maximum color temperatures
+// the Nanoleaf reports supporting. The range is fetched once and cached for
+// the lifetime of the client. If the Nanoleaf doesn't report a range, the
+// API's documented 1200-6500K is returned.
+func (c *Client) ColorTemperatureRange(ctx context.Context) (lo, hi int, err error) {
+	if c.temperatureRange != nil {
+		return c.temperatureRange[0], c.temperatureRange[1], nil
+	}
+
+	state, err := c.GetState(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lo, hi = 1200, 6500
+	if ct := state.ColorTemperature; ct != nil && ct.Min != nil && ct.Max != nil {
+		lo, hi = *ct.Min, *ct.Max
+	}
+	c.temperatureRange = &[2]int{lo, hi}
+	return lo, hi, nil
+}
+
+// SetHSL sets the Nanoleaf's hue, saturation, and lightness, transitioning
+// over duration seconds. The Nanoleaf natively uses HSV (hue, saturation,
+// brightness), so the color is converted before sending.
+func (c *Client) SetHSL(ctx context.Context, hue int, sat int, lightness int, duration int) error {
+	h, s, v := HSLToHSV(hue, sat, lightness)
+	return c.SetHSV(ctx, h, s, v, duration)
+}
+
+// SetHSV sets the Nanoleaf's hue, saturation, and brightness, transitioning
+// over duration seconds.
+func (c *Client) SetHSV(ctx context.Context, hue int, sat int, brightness int, duration int) error {
+	state := State{
+		Brightness: &BrightnessProperty{Value: brightness, Duration: duration},
+		Hue:        &HueProperty{Value: hue, Duration: duration},
+		Saturation: &SaturationProperty{Value: sat, Duration: duration},
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Put(ctx, "state", bytes)
+	return err
+}
+
+// SetRGB sets the Nanoleaf's color by converting RGB to HSV, transitioning
+// over duration seconds.
+func (c *Client) SetRGB(ctx context.Context, red int, green int, blue int, duration int) error {
+	h, s, v := RGBToHSV(red, green, blue)
+	return c.SetHSV(ctx, h, s, v, duration)
+}
+
+// StartExternalControl sets the Nanoleaf to accept UDP input, returning the
+// address to stream frames to.
+func (c *Client) StartExternalControl(ctx context.Context) (*net.UDPAddr, error) {
+	_, err := c.Put(ctx, "effects", []byte(`{"write":{"command":"display","animType":"extControl","extControlVersion":"v2"}}`))
+	if err != nil {
+		return nil, err
+	}
+
+	hostAddr, err := net.ResolveTCPAddr("tcp", c.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", hostAddr.IP, ExternalControlPort))
+}
+
+// SetPanelColor represents a frame of external color data.
+type SetPanelColor struct {
+	PanelID        uint16
+	Red            uint8
+	Green          uint8
+	Blue           uint8
+	White          uint8
+	TransitionTime uint16
+}
+
+// SetCustomColors sets individual Nanoleaf pane colors. It enables external
+// control and opens a new UDP socket on every call; use StreamPanelColors to
+// send a sequence of frames.
+func (c *Client) SetCustomColors(ctx context.Context, frames []SetPanelColor) error {
+	raddr, err := c.StartExternalControl(ctx)
+	if err != nil {
+		return err
+	}
+
+	buf, err := encodeFrames(frames)
+	if err != nil {
+		return err
+	}
+
+	if c.DryRun {
+		c.printFrames(raddr, frames)
+		return nil
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(buf)
+	return err
+}
+
+// StreamPanelColors sets individual Nanoleaf panel colors over a persistent
+// UDP socket. External control is enabled and the socket opened on the first
+// call, so subsequent frames cost a single UDP packet. Call Close to release
+// the socket when done.
+func (c *Client) StreamPanelColors(ctx context.Context, frames []SetPanelColor) error {
+	buf, err := encodeFrames(frames)
+	if err != nil {
+		return err
+	}
+
+	if c.streamAddr == nil {
+		raddr, err := c.StartExternalControl(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !c.DryRun {
+			c.stream, err = net.DialUDP("udp", nil, raddr)
+			if err != nil {
+				return err
+			}
+		}
+		c.streamAddr = raddr
+	}
+
+	if c.DryRun {
+		c.printFrames(c.streamAddr, frames)
+		return nil
+	}
+
+	_, err = c.stream.Write(buf)
+	return err
+}
+
+// Close closes the UDP socket opened by StreamPanelColors, if any.
+func (c *Client) Close() error {
+	c.streamAddr = nil
+	if c.stream == nil {
+		return nil
+	}
+	err := c.stream.Close()
+	c.stream = nil
+	return err
+}
+
+// encodeFrames encodes frames as a v2 external control packet.
+func encodeFrames(frames []SetPanelColor) ([]byte, error) {
+	numPanels := len(frames)
+	if numPanels > math.MaxUint16 {
+		return nil, fmt.Errorf("Expected between 0-%d panels, got %d", math.MaxUint16, numPanels)
+	}
+
+	headerSize := 2
+	panelFrameSize := 8
+	controlFrameSize := headerSize + panelFrameSize*numPanels
+	buf := make([]byte, controlFrameSize)
+	binary.BigEndian.PutUint16(buf, uint16(numPanels))
+	for i, panel := range frames {
+		offset := headerSize + panelFrameSize*i
+		binary.BigEndian.PutUint16(buf[offset:], panel.PanelID)
+		buf[offset+2] = panel.Red
+		buf[offset+3] = panel.Green
+		buf[offset+4] = panel.Blue
+		buf[offset+5] = panel.White
+		binary.BigEndian.PutUint16(buf[offset+6:], panel.TransitionTime)
+	}
+	return buf, nil
+}
+
+// printFrames prints the frames that would be sent to raddr in dry-run mode.
+func (c *Client) printFrames(raddr *net.UDPAddr, frames []SetPanelColor) {
+	out := c.output()
+	fmt.Fprintln(out, "UDP", raddr)
+	for _, panel := range frames {
+		fmt.Fprintf(out, "panel %d: rgbw(%d, %d, %d, %d) transition %d\n",
+			panel.PanelID, panel.Red, panel.Green, panel.Blue, panel.White, panel.TransitionTime)
+	}
+	fmt.Fprintln(out)
+}
+
+// BrightnessProperty represents the brightness of the Nanoleaf.
+type BrightnessProperty struct {
+	Min      *int `json:"min,omitempty"`
+	Max      *int `json:"max,omitempty"`
+	Value    int  `json:"value"`
+	Duration int  `json:"duration,omitempty"`
+}
+
+// ColorTemperatureProperty represents the color temperature of the Nanoleaf.
+type ColorTemperatureProperty struct {
+	Min      *int `json:"min,omitempty"`
+	Max      *int `json:"max,omitempty"`
+	Value    int  `json:"value"`
+	Duration int  `json:"duration,omitempty"`
+}
+
+// HueProperty represents the hue of the Nanoleaf.
+type HueProperty struct {
+	Min      *int `json:"min,omitempty"`
+	Max      *int `json:"max,omitempty"`
+	Value    int  `json:"value"`
+	Duration int  `json:"duration,omitempty"`
+}
+
+// OnProperty represents the power state of the Nanoleaf.
+type OnProperty struct {
+	Value bool `json:"value"`
+}
+
+// SaturationProperty represents the saturation of the Nanoleaf.
+type SaturationProperty struct {
+	Min      *int `json:"min,omitempty"`
+	Max      *int `json:"max,omitempty"`
+	Value    int  `json:"value"`
+	Duration int  `json:"duration,omitempty"`
+}
+
+// State represents a Nanoleaf state.
+type State struct {
+	On               *OnProperty               `json:"on,omitempty"`
+	Brightness       *BrightnessProperty       `json:"brightness,omitempty"`
+	ColorTemperature *ColorTemperatureProperty `json:"ct,omitempty"`
+	Hue              *HueProperty              `json:"hue,omitempty"`
+	Saturation       *SaturationProperty       `json:"sat,omitempty"`
+	ColorMode        string                    `json:"colorMode,omitempty"`
+}
+
+// incrementProperty represents a relative change to a Nanoleaf state value.
+type incrementProperty struct {
+	Increment int `json:"increment"`
+}
+
+// stateIncrementRequest represents a JSON PUT body for relative changes to
+// `state`.
+type stateIncrementRequest struct {
+	Brightness       *incrementProperty `json:"brightness,omitempty"`
+	Hue              *incrementProperty `json:"hue,omitempty"`
+	Saturation       *incrementProperty `json:"sat,omitempty"`
+	ColorTemperature *incrementProperty `json:"ct,omitempty"`
+}
+
+// nameRequest represents a JSON PUT body for renaming the Nanoleaf.
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+// effectsSelectRequest represents a JSON PUT body for `effects/select`.
+type effectsSelectRequest struct {
+	Select string `json:"select"`
+}
+
+// orientationRequest represents a JSON PUT body for `panelLayout`.
+type orientationRequest struct {
+	GlobalOrientation valueProperty `json:"globalOrientation"`
+}
+
+// valueProperty represents a JSON object holding a single value.
+type valueProperty struct {
+	Value int `json:"value"`
+}
+
+// effectsWriteRequest represents a JSON PUT body for an `effects` write
+// command.
+type effectsWriteRequest struct {
+	Write effectCommand `json:"write"`
+}
+
+// effectCommand represents an `effects` write command.
+type effectCommand struct {
+	Command  string `json:"command"`
+	AnimName string `json:"animName,omitempty"`
+}
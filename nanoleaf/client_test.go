@@ -0,0 +1,248 @@
+package nanoleaf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client for a test server running handler.
+func newTestClient(t testing.TB, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Client{
+		Host:  strings.TrimPrefix(server.URL, "http://"),
+		Token: "SECRETTOKEN123456",
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      func(ctx context.Context, c *Client) error
+		requests int32
+	}{
+		{"absolute", func(ctx context.Context, c *Client) error { return c.SetBrightness(ctx, 50, 0) }, 2},
+		{"increment", func(ctx context.Context, c *Client) error { return c.AdjustBrightness(ctx, 10) }, 1},
+		{"delete effect", func(ctx context.Context, c *Client) error { return c.DeleteEffect(ctx, "Forest") }, 1},
+		{"import effect", func(ctx context.Context, c *Client) error { return c.ImportEffect(ctx, []byte("{}")) }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fail the first request, as if the Nanoleaf applied it
+			// but then errored.
+			var requests atomic.Int32
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			c.Retries = 2
+
+			tt.set(context.Background(), c)
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("sent %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestErrorsMaskToken(t *testing.T) {
+	const token = "SECRETTOKEN123456"
+	tests := []struct {
+		name string
+		host string
+		call func(ctx context.Context, c *Client) error
+	}{
+		{"connection refused", "127.0.0.1:1", func(ctx context.Context, c *Client) error { return c.On(ctx) }},
+		{"get", "127.0.0.1:1", func(ctx context.Context, c *Client) error { _, err := c.GetState(ctx); return err }},
+		{"invalid host", "bad host", func(ctx context.Context, c *Client) error { return c.On(ctx) }},
+		{"touch events", "127.0.0.1:1", func(ctx context.Context, c *Client) error { _, err := c.SubscribeTouch(ctx); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Host: tt.host, Token: token}
+			err := tt.call(context.Background(), c)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if strings.Contains(err.Error(), token) {
+				t.Errorf("error contains the access token: %v", err)
+			}
+		})
+	}
+}
+
+func TestReboot(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		unsupported bool
+	}{
+		{"supported", http.StatusNoContent, false},
+		{"unsupported", http.StatusNotFound, true},
+		{"unauthorized", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || !strings.HasSuffix(r.URL.Path, "/reboot") {
+					t.Errorf("got %s %s, want PUT .../reboot", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+			}))
+
+			err := c.Reboot(context.Background())
+			if tt.status == http.StatusNoContent && err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got := errors.Is(err, ErrRebootUnsupported); got != tt.unsupported {
+				t.Errorf("errors.Is(%v, ErrRebootUnsupported) = %t, want %t", err, got, tt.unsupported)
+			}
+			var apiErr *APIError
+			if tt.status != http.StatusNoContent && !errors.As(err, &apiErr) {
+				t.Errorf("got error %v, want an *APIError", err)
+			}
+		})
+	}
+}
+
+func TestDryRunOutput(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("sent %s %s in a dry run", r.Method, r.URL.Path)
+	}))
+	var out strings.Builder
+	c.DryRun = true
+	c.Output = &out
+
+	err := c.On(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "PUT " + c.maskedEndpoint("state") + "\n" + `{"on":{"value":true}}` + "\n\n"
+	if out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestFlash(t *testing.T) {
+	const (
+		on      = `{"on":{"value":true}}`
+		off     = `{"on":{"value":false}}`
+		restore = `{"select":"Forest"} {"brightness":{"value":40}} ` + on
+	)
+	tests := []struct {
+		name     string
+		failPut  int
+		requests string
+	}{
+		{"blinks then restores", 0, off + " " + on + " " + off + " " + on + " " + restore},
+		{"restores after a failed switch", 2, off + " " + on + " " + restore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var puts []string
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					fmt.Fprint(w, `{"state":{"on":{"value":true},"brightness":{"value":40},"colorMode":"effect"},"effects":{"select":"Forest"}}`)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				puts = append(puts, string(body))
+				if len(puts) == tt.failPut {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			err := c.Flash(context.Background(), 2, time.Millisecond)
+			if failed := err != nil; failed != (tt.failPut > 0) {
+				t.Errorf("Flash returned error %v, want error: %t", err, tt.failPut > 0)
+			}
+			if got := strings.Join(puts, " "); got != tt.requests {
+				t.Errorf("sent %s, want %s", got, tt.requests)
+			}
+		})
+	}
+}
+
+func BenchmarkStreamPanelColors(b *testing.B) {
+	// Frames are streamed to the external control port on the Nanoleaf's
+	// host, so listen there to receive them.
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: ExternalControlPort})
+	if err != nil {
+		b.Skipf("can't listen on the external control port: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := newTestClient(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer c.Close()
+
+	for _, panels := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("%d panels", panels), func(b *testing.B) {
+			frames := make([]SetPanelColor, panels)
+			for i := range frames {
+				frames[i] = SetPanelColor{PanelID: uint16(i), Red: 255, TransitionTime: 1}
+			}
+
+			ctx := context.Background()
+			for b.Loop() {
+				err := c.StreamPanelColors(ctx, frames)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "frames/s")
+		})
+	}
+}
+
+func BenchmarkSetRGB(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// The shared transport keeps connections alive between requests,
+	// compared to opening a new connection for each one.
+	b.Run("keep-alive", func(b *testing.B) {
+		c := newTestClient(b, handler)
+		ctx := context.Background()
+		for b.Loop() {
+			if err := c.SetRGB(ctx, 255, 128, 0, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("new connection", func(b *testing.B) {
+		c := newTestClient(b, handler)
+		c.client.Transport = &http.Transport{DisableKeepAlives: true}
+		ctx := context.Background()
+		for b.Loop() {
+			if err := c.SetRGB(ctx, 255, 128, 0, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package nanoleaf
+
+import "math"
+
+// The conversions below use the Nanoleaf's integer ranges: hue 0-360,
+// saturation, brightness, and lightness 0-100, and red, green, and blue
+// 0-255. Values are only rounded once, at the end of each conversion.
+
+// RGBToHSV converts red, green, and blue values (0-255) to a hue (0-360),
+// saturation (0-100), and brightness (0-100).
+func RGBToHSV(red, green, blue int) (int, int, int) {
+	r := float64(red) / 255.0
+	g := float64(green) / 255.0
+	b := float64(blue) / 255.0
+
+	max := math.Max(math.Max(r, g), b)
+	min := math.Min(math.Min(r, g), b)
+	c := max - min
+
+	if c == 0 { // achromatic
+		return 0, 0, int(math.Round(100 * max))
+	}
+
+	h := 0.0
+	switch max {
+	case r:
+		h = math.Mod((g-b)/c, 6)
+	case g:
+		h = 2 + (b-r)/c
+	case b:
+		h = 4 + (r-g)/c
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	return roundHue(h), int(math.Round(100 * c / max)), int(math.Round(100 * max))
+}
+
+// HSVToRGB converts a hue (0-360), saturation (0-100), and brightness
+// (0-100) to red, green, and blue values (0-255).
+func HSVToRGB(hue, sat, brightness int) (int, int, int) {
+	h := math.Mod(float64(hue), 360) / 60
+	s := float64(sat) / 100.0
+	v := float64(brightness) / 100.0
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+
+	var r, g, b float64
+	switch {
+	case h < 1:
+		r, g, b = c, x, 0
+	case h < 2:
+		r, g, b = x, c, 0
+	case h < 3:
+		r, g, b = 0, c, x
+	case h < 4:
+		r, g, b = 0, x, c
+	case h < 5:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	m := v - c
+	return int(math.Round(255 * (r + m))), int(math.Round(255 * (g + m))), int(math.Round(255 * (b + m)))
+}
+
+// HSLToHSV converts a hue (0-360), saturation (0-100), and lightness (0-100)
+// to a hue, saturation, and brightness. The hue is unchanged.
+func HSLToHSV(hue, sat, lightness int) (int, int, int) {
+	s := float64(sat) / 100.0
+	l := float64(lightness) / 100.0
+
+	v := l + s*math.Min(l, 1-l)
+	if v == 0 { // black
+		return hue, 0, 0
+	}
+
+	return hue, int(math.Round(100 * 2 * (1 - l/v))), int(math.Round(100 * v))
+}
+
+// HSVToHSL converts a hue (0-360), saturation (0-100), and brightness
+// (0-100) to a hue, saturation, and lightness. The hue is unchanged.
+func HSVToHSL(hue, sat, brightness int) (int, int, int) {
+	s := float64(sat) / 100.0
+	v := float64(brightness) / 100.0
+
+	l := v * (1 - s/2)
+	if l == 0 || l == 1 { // black or white
+		return hue, 0, int(math.Round(100 * l))
+	}
+
+	return hue, int(math.Round(100 * (v - l) / math.Min(l, 1-l))), int(math.Round(100 * l))
+}
+
+// MixRGB returns the color a fraction t (0-1) of the way from one sRGB color
+// (0-255) to another. The colors are mixed in linear light, which avoids the
+// dark, muddy midpoints of mixing the gamma-encoded values directly.
+func MixRGB(red1, green1, blue1, red2, green2, blue2 int, t float64) (int, int, int) {
+	mix := func(a, b int) int {
+		la, lb := srgbToLinear(a), srgbToLinear(b)
+		return linearToSRGB(la + (lb-la)*t)
+	}
+	return mix(red1, red2), mix(green1, green2), mix(blue1, blue2)
+}
+
+// srgbToLinear converts a gamma-encoded sRGB value (0-255) to linear light
+// (0-1).
+func srgbToLinear(v int) float64 {
+	c := float64(v) / 255.0
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts linear light (0-1) to a gamma-encoded sRGB value
+// (0-255).
+func linearToSRGB(l float64) int {
+	c := 12.92 * l
+	if l > 0.0031308 {
+		c = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+	return int(math.Round(255 * math.Max(0, math.Min(c, 1))))
+}
+
+// roundHue rounds a hue in degrees, wrapping 360 to 0.
+func roundHue(h float64) int {
+	return int(math.Round(h)) % 360
+}
@@ -0,0 +1,181 @@
+package nanoleaf
+
+import "testing"
+
+func TestRGBToHSV(t *testing.T) {
+	tests := []struct {
+		name                 string
+		red, green, blue     int
+		hue, sat, brightness int
+	}{
+		{"red", 255, 0, 0, 0, 100, 100},
+		{"yellow", 255, 255, 0, 60, 100, 100},
+		{"green", 0, 255, 0, 120, 100, 100},
+		{"cyan", 0, 255, 255, 180, 100, 100},
+		{"blue", 0, 0, 255, 240, 100, 100},
+		{"magenta", 255, 0, 255, 300, 100, 100},
+		{"hue 360 wraps to 0", 255, 0, 1, 0, 100, 100},
+		{"white", 255, 255, 255, 0, 0, 100},
+		{"gray", 128, 128, 128, 0, 0, 50},
+		{"black", 0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hue, sat, brightness := RGBToHSV(tt.red, tt.green, tt.blue)
+			if hue != tt.hue || sat != tt.sat || brightness != tt.brightness {
+				t.Errorf("RGBToHSV(%d, %d, %d) = %d, %d, %d, want %d, %d, %d",
+					tt.red, tt.green, tt.blue, hue, sat, brightness, tt.hue, tt.sat, tt.brightness)
+			}
+		})
+	}
+}
+
+func TestRGBHSVRoundTrip(t *testing.T) {
+	// HSV has only 101 steps of saturation and brightness, so a round trip
+	// can be off by a little over one step of 255.
+	const tolerance = 3
+	colors := [][3]int{
+		{255, 0, 0}, {0, 255, 0}, {0, 0, 255}, {255, 255, 255}, {0, 0, 0},
+		{255, 128, 0}, {12, 34, 56}, {200, 100, 150}, {1, 2, 3}, {254, 253, 252},
+	}
+	for _, color := range colors {
+		red, green, blue := HSVToRGB(RGBToHSV(color[0], color[1], color[2]))
+		got := [3]int{red, green, blue}
+		for i := range got {
+			if diff := got[i] - color[i]; diff < -tolerance || diff > tolerance {
+				t.Errorf("HSVToRGB(RGBToHSV(%v)) = %v, want within %d of each", color, got, tolerance)
+				break
+			}
+		}
+	}
+}
+
+func TestHSVToRGBBoundaries(t *testing.T) {
+	tests := []struct {
+		name                 string
+		hue, sat, brightness int
+		red, green, blue     int
+	}{
+		{"hue 360 is red", 360, 100, 100, 255, 0, 0},
+		{"no saturation is gray", 200, 0, 50, 128, 128, 128},
+		{"no brightness is black", 120, 100, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, green, blue := HSVToRGB(tt.hue, tt.sat, tt.brightness)
+			if red != tt.red || green != tt.green || blue != tt.blue {
+				t.Errorf("HSVToRGB(%d, %d, %d) = %d, %d, %d, want %d, %d, %d",
+					tt.hue, tt.sat, tt.brightness, red, green, blue, tt.red, tt.green, tt.blue)
+			}
+		})
+	}
+}
+
+func TestHSVHSLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name                 string
+		hue, sat, brightness int
+		hslSat, lightness    int
+	}{
+		{"full color", 0, 100, 100, 100, 50},
+		{"pastel", 210, 50, 100, 100, 75},
+		{"dark", 90, 100, 50, 100, 25},
+		{"white", 0, 0, 100, 0, 100},
+		{"gray", 0, 0, 50, 0, 50},
+		{"black", 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hue, sat, lightness := HSVToHSL(tt.hue, tt.sat, tt.brightness)
+			if hue != tt.hue || sat != tt.hslSat || lightness != tt.lightness {
+				t.Errorf("HSVToHSL(%d, %d, %d) = %d, %d, %d, want %d, %d, %d",
+					tt.hue, tt.sat, tt.brightness, hue, sat, lightness, tt.hue, tt.hslSat, tt.lightness)
+			}
+
+			hue, sat, brightness := HSLToHSV(hue, sat, lightness)
+			if hue != tt.hue || sat != tt.sat || brightness != tt.brightness {
+				t.Errorf("HSLToHSV(HSVToHSL(%d, %d, %d)) = %d, %d, %d",
+					tt.hue, tt.sat, tt.brightness, hue, sat, brightness)
+			}
+		})
+	}
+}
+
+func TestMixRGB(t *testing.T) {
+	tests := []struct {
+		name             string
+		from, to         [3]int
+		t                float64
+		red, green, blue int
+	}{
+		{"start", [3]int{255, 0, 0}, [3]int{0, 0, 255}, 0, 255, 0, 0},
+		{"end", [3]int{255, 0, 0}, [3]int{0, 0, 255}, 1, 0, 0, 255},
+		// Half of linear light is brighter than half the sRGB value.
+		{"midpoint", [3]int{0, 0, 0}, [3]int{255, 255, 255}, 0.5, 188, 188, 188},
+		{"quarter", [3]int{0, 0, 0}, [3]int{255, 255, 255}, 0.25, 137, 137, 137},
+		{"red to blue", [3]int{255, 0, 0}, [3]int{0, 0, 255}, 0.5, 188, 0, 188},
+		{"same color", [3]int{12, 34, 56}, [3]int{12, 34, 56}, 0.5, 12, 34, 56},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, green, blue := MixRGB(tt.from[0], tt.from[1], tt.from[2], tt.to[0], tt.to[1], tt.to[2], tt.t)
+			if red != tt.red || green != tt.green || blue != tt.blue {
+				t.Errorf("MixRGB(%v, %v, %v) = %d, %d, %d, want %d, %d, %d",
+					tt.from, tt.to, tt.t, red, green, blue, tt.red, tt.green, tt.blue)
+			}
+		})
+	}
+}
+
+func TestHSLToHSV(t *testing.T) {
+	tests := []struct {
+		name                string
+		hue, sat, lightness int
+		hsvSat, brightness  int
+	}{
+		{"lightness 0 is black", 120, 100, 0, 0, 0},
+		{"lightness 0 without saturation is black", 120, 0, 0, 0, 0},
+		{"lightness 100 is white", 120, 100, 100, 0, 100},
+		{"lightness 100 without saturation is white", 120, 0, 100, 0, 100},
+		{"lightness 50 with full saturation is the pure hue", 120, 100, 50, 100, 100},
+		{"lightness 50 without saturation is gray", 120, 0, 50, 0, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hue, sat, brightness := HSLToHSV(tt.hue, tt.sat, tt.lightness)
+			if hue != tt.hue || sat != tt.hsvSat || brightness != tt.brightness {
+				t.Errorf("HSLToHSV(%d, %d, %d) = %d, %d, %d, want %d, %d, %d",
+					tt.hue, tt.sat, tt.lightness, hue, sat, brightness, tt.hue, tt.hsvSat, tt.brightness)
+			}
+		})
+	}
+}
+
+func TestHSVToRGB(t *testing.T) {
+	tests := []struct {
+		name                 string
+		hue, sat, brightness int
+		red, green, blue     int
+	}{
+		// One case in each 60° sector of the hue circle.
+		{"red to yellow", 30, 100, 100, 255, 128, 0},
+		{"yellow to green", 90, 100, 100, 128, 255, 0},
+		{"green to cyan", 150, 100, 100, 0, 255, 128},
+		{"cyan to blue", 210, 100, 100, 0, 128, 255},
+		{"blue to magenta", 270, 100, 100, 128, 0, 255},
+		{"magenta to red", 330, 100, 100, 255, 0, 128},
+		{"sector boundary", 120, 100, 100, 0, 255, 0},
+		{"half brightness", 0, 100, 50, 128, 0, 0},
+		{"no saturation is white", 0, 0, 100, 255, 255, 255},
+		{"no saturation ignores hue", 300, 0, 20, 51, 51, 51},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, green, blue := HSVToRGB(tt.hue, tt.sat, tt.brightness)
+			if red != tt.red || green != tt.green || blue != tt.blue {
+				t.Errorf("HSVToRGB(%d, %d, %d) = %d, %d, %d, want %d, %d, %d",
+					tt.hue, tt.sat, tt.brightness, red, green, blue, tt.red, tt.green, tt.blue)
+			}
+		})
+	}
+}
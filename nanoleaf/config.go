@@ -0,0 +1,46 @@
+package nanoleaf
+
+import "fmt"
+
+// HostConfig defines the structure for individual host configurations.
+type HostConfig struct {
+	PanelName   string `mapstructure:"panel_name,required" toml:"panel_name" yaml:"panel_name" json:"panel_name"`
+	Host        string `mapstructure:"host,required" toml:"host" yaml:"host" json:"host"`
+	AccessToken string `mapstructure:"access_token,required" toml:"access_token" yaml:"access_token" json:"access_token"`
+	Timeout     string `mapstructure:"timeout" toml:"timeout,omitempty" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// MinInterval is the minimum time between commands sent to the panel
+	// by separate microleaf invocations, e.g. "500ms".
+	MinInterval string `mapstructure:"min_interval" toml:"min_interval,omitempty" yaml:"min_interval,omitempty" json:"min_interval,omitempty"`
+	// DefaultCommand is run when the panel is selected without a command.
+	DefaultCommand string `mapstructure:"default_command" toml:"default_command,omitempty" yaml:"default_command,omitempty" json:"default_command,omitempty"`
+}
+
+// String returns the host configuration with the access token masked, so
+// that it can be safely logged.
+func (c HostConfig) String() string {
+	return fmt.Sprintf(
+		"{PanelName:%s Host:%s AccessToken:%s Timeout:%s MinInterval:%s DefaultCommand:%s}",
+		c.PanelName, c.Host, maskToken(c.AccessToken), c.Timeout, c.MinInterval, c.DefaultCommand,
+	)
+}
+
+// MicroleafConfig defines the overall structure of the configuration file.
+type MicroleafConfig struct {
+	HostConfigs []HostConfig `mapstructure:"host_configs" toml:"host_configs" yaml:"host_configs" json:"host_configs"`
+	// Groups maps a group name to the panel names it contains, so that a set
+	// of panels can be selected by a single name.
+	Groups map[string][]string `mapstructure:"groups" toml:"groups,omitempty" yaml:"groups,omitempty" json:"groups,omitempty"`
+	// Profiles maps a profile name to an alternative set of host configs
+	// and groups, used in place of the top-level ones when selected.
+	Profiles map[string]Profile `mapstructure:"profiles" toml:"profiles,omitempty" yaml:"profiles,omitempty" json:"profiles,omitempty"`
+	// Scenes maps a scene name to the command lines it runs, in order, e.g.
+	// ["brightness 40", "rgb orange"].
+	Scenes map[string][]string `mapstructure:"scenes" toml:"scenes,omitempty" yaml:"scenes,omitempty" json:"scenes,omitempty"`
+}
+
+// Profile defines a named set of host configs and groups within the
+// configuration file.
+type Profile struct {
+	HostConfigs []HostConfig        `mapstructure:"host_configs" toml:"host_configs" yaml:"host_configs" json:"host_configs"`
+	Groups      map[string][]string `mapstructure:"groups" toml:"groups,omitempty" yaml:"groups,omitempty" json:"groups,omitempty"`
+}
@@ -0,0 +1,106 @@
+package nanoleaf
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+// DiscoveryService is the mDNS service type advertised by Nanoleaf devices.
+const DiscoveryService = "_nanoleafapi._tcp"
+
+// DiscoveredPanel represents a Nanoleaf device found via mDNS.
+type DiscoveredPanel struct {
+	Name  string `json:"name"`
+	Host  string `json:"host"`
+	Model string `json:"model"`
+}
+
+// Discover browses the local network for Nanoleaf devices, waiting at most
+// timeout for responses.
+func Discover(timeout time.Duration) ([]DiscoveredPanel, error) {
+	entries := make(chan *mdns.ServiceEntry, 16)
+	params := mdns.DefaultParams(DiscoveryService)
+	params.Timeout = timeout
+	params.Entries = entries
+	params.DisableIPv6 = true
+	// The mdns package logs routine messages, which would otherwise end up
+	// in the standard logger's output.
+	params.Logger = log.New(io.Discard, "", 0)
+
+	var panels []DiscoveredPanel
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		seen := make(map[string]bool)
+		for entry := range entries {
+			panel := newDiscoveredPanel(entry)
+			if panel.Host == "" || seen[panel.Host] {
+				continue
+			}
+			seen[panel.Host] = true
+			panels = append(panels, panel)
+		}
+	}()
+
+	err := mdns.Query(params)
+	close(entries)
+	<-done
+	return panels, err
+}
+
+// newDiscoveredPanel converts an mDNS service entry into a DiscoveredPanel.
+func newDiscoveredPanel(entry *mdns.ServiceEntry) DiscoveredPanel {
+	name := strings.TrimSuffix(entry.Name, ".")
+	name = strings.TrimSuffix(name, ".local")
+	name = strings.TrimSuffix(name, "."+DiscoveryService)
+	name = strings.ReplaceAll(name, `\ `, " ")
+
+	var host string
+	if entry.AddrV4 != nil {
+		host = net.JoinHostPort(entry.AddrV4.String(), strconv.Itoa(entry.Port))
+	}
+
+	var model string
+	for _, field := range entry.InfoFields {
+		if value, ok := strings.CutPrefix(field, "md="); ok {
+			model = value
+		}
+	}
+
+	return DiscoveredPanel{
+		Name:  name,
+		Host:  host,
+		Model: model,
+	}
+}
+
+// DiscoverHost looks up the host of the Nanoleaf named panelName, ignoring
+// case. Devices with other names are never used in its place.
+func DiscoverHost(panelName string, timeout time.Duration) (string, error) {
+	panels, err := Discover(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	for _, panel := range panels {
+		if strings.EqualFold(panel.Name, panelName) {
+			return panel.Host, nil
+		}
+	}
+
+	switch len(panels) {
+	case 0:
+		return "", fmt.Errorf("no Nanoleaf devices found")
+	case 1:
+		return "", fmt.Errorf("found 1 Nanoleaf device, named %q, not %q", panels[0].Name, panelName)
+	default:
+		return "", fmt.Errorf("found %d Nanoleaf devices, none named %q", len(panels), panelName)
+	}
+}
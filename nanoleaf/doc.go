@@ -0,0 +1,16 @@
+// Package nanoleaf is a client for the Nanoleaf REST API.
+//
+// A Client is created from the panel's host and an access token obtained
+// with Pair:
+//
+//	client := &nanoleaf.Client{
+//		Host:  "192.168.1.20:16021",
+//		Token: token,
+//	}
+//	err := client.TurnOnWithBrightness(ctx, 40)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Panels on the local network can be found with Discover.
+package nanoleaf
@@ -0,0 +1,163 @@
+package nanoleaf
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// touchEventType is the event type ID of touch events in the `events`
+// stream.
+const touchEventType = 4
+
+// Gesture is a touch gesture recognized by Canvas and Shapes panels.
+type Gesture int
+
+const (
+	GestureSingleTap Gesture = iota
+	GestureDoubleTap
+	GestureSwipeUp
+	GestureSwipeDown
+	GestureSwipeLeft
+	GestureSwipeRight
+)
+
+// String returns the gesture's name, e.g. "single tap".
+func (g Gesture) String() string {
+	switch g {
+	case GestureSingleTap:
+		return "single tap"
+	case GestureDoubleTap:
+		return "double tap"
+	case GestureSwipeUp:
+		return "swipe up"
+	case GestureSwipeDown:
+		return "swipe down"
+	case GestureSwipeLeft:
+		return "swipe left"
+	case GestureSwipeRight:
+		return "swipe right"
+	default:
+		return fmt.Sprintf("gesture %d", int(g))
+	}
+}
+
+// TouchEvent is a gesture reported by the Nanoleaf. Swipes aren't tied to a
+// single panel, so their PanelID is -1.
+type TouchEvent struct {
+	PanelID int     `json:"panelId"`
+	Gesture Gesture `json:"gesture"`
+}
+
+// touchEvents represents the data of a touch event in the `events` stream.
+type touchEvents struct {
+	Events []TouchEvent `json:"events"`
+}
+
+// SubscribeTouch registers for the Nanoleaf's touch events, returning a
+// channel that receives each gesture as it happens. The channel is closed
+// when ctx is done or the event stream ends; errors reading the stream are
+// logged. Only Canvas and Shapes panels report touch events.
+func (c *Client) SubscribeTouch(ctx context.Context) (<-chan TouchEvent, error) {
+	path := fmt.Sprintf("events?id=%d", touchEventType)
+	log := c.logger()
+	log.Info("request", "method", http.MethodGet, "path", path)
+	log.Debug("request", "method", http.MethodGet, "url", c.maskedEndpoint(path))
+
+	// The stream stays open indefinitely, so the timeout only applies
+	// until the response headers arrive.
+	client := c.httpClient()
+	timeout := client.Timeout
+	client.Timeout = 0
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+
+	req, err := http.NewRequestWithContext(c.withConnectTimeout(ctx), http.MethodGet, c.Endpoint(path), nil)
+	if err != nil {
+		cancel()
+		return nil, c.maskURLError(err, path)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := client.Do(req)
+	if !timer.Stop() {
+		cancel()
+		if err == nil {
+			res.Body.Close()
+		}
+		return nil, fmt.Errorf("panel did not respond within %s", timeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, c.checkConnectTimeout(c.maskURLError(err, path))
+	}
+
+	log.Info("response", "method", http.MethodGet, "path", path, "status", res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer cancel()
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return nil, checkStatus(res.StatusCode, string(body))
+	}
+
+	events := make(chan TouchEvent)
+	go func() {
+		defer close(events)
+		defer cancel()
+		defer res.Body.Close()
+
+		err := readTouchEvents(ctx, bufio.NewScanner(res.Body), events)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("failed to read touch events", "err", err)
+		}
+	}()
+	return events, nil
+}
+
+// readTouchEvents parses the server-sent events from scanner, sending each
+// touch event on events, until the stream ends or ctx is done.
+func readTouchEvents(ctx context.Context, scanner *bufio.Scanner, events chan<- TouchEvent) error {
+	var id, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id = value
+			case "data":
+				data += value
+			}
+			continue
+		}
+
+		// A blank line ends the event.
+		if id == fmt.Sprint(touchEventType) && data != "" {
+			var touch touchEvents
+			if err := json.Unmarshal([]byte(data), &touch); err != nil {
+				return fmt.Errorf("invalid touch event %q: %w", data, err)
+			}
+			for _, event := range touch.Events {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		id, data = "", ""
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("event stream closed by the Nanoleaf")
+}
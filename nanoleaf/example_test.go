@@ -0,0 +1,58 @@
+package nanoleaf_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/clukawski/microleaf/nanoleaf"
+)
+
+// fakeNanoleaf stands in for a Nanoleaf, keeping the state written to it.
+func fakeNanoleaf() *httptest.Server {
+	state := map[string]any{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/state") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&state)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(state)
+	}))
+}
+
+func Example() {
+	server := fakeNanoleaf()
+	defer server.Close()
+
+	// The host is usually the Nanoleaf's address, e.g.
+	// "192.168.1.20:16021", and the token comes from Pair.
+	client := &nanoleaf.Client{
+		Host:  strings.TrimPrefix(server.URL, "http://"),
+		Token: "token",
+	}
+
+	ctx := context.Background()
+	err := client.TurnOnWithBrightness(ctx, 40)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state, err := client.GetState(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("on:", state.On.Value)
+	fmt.Println("brightness:", state.Brightness.Value)
+	// Output:
+	// on: true
+	// brightness: 40
+}
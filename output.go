@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the formats accepted by -o/-output, text being each
+// command's usual human-readable output.
+var outputFormats = []string{"text", "json", "yaml"}
+
+// addOutputFlag adds the -o and -output flags to fs, which both set the same
+// output format. Call outputFormat after parsing to get the chosen format.
+func addOutputFlag(fs *flag.FlagSet) *string {
+	format := fs.String("output", "", "Output format: text, json, or yaml")
+	fs.StringVar(format, "o", "", "Shorthand for -output")
+	return format
+}
+
+// outputFormat validates the format set with -o/-output, defaulting to json
+// with the global -json flag and to text otherwise.
+func outputFormat(format string) (string, error) {
+	if format == "" {
+		if *jsonOutput {
+			return "json", nil
+		}
+		return "text", nil
+	}
+	if !slices.Contains(outputFormats, format) {
+		return "", fmt.Errorf("output format must be one of: %s", strings.Join(outputFormats, ", "))
+	}
+	return format, nil
+}
+
+// render writes v to w in a structured output format, i.e. anything but
+// text, which callers print themselves.
+func render(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case "json":
+		return printJSON(w, v)
+	case "yaml":
+		return printYAML(w, v)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+// printYAML writes v to w as YAML. v is encoded as JSON first, so its JSON
+// field names and order are used rather than yaml.v3's lowercased Go names.
+func printYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+
+	// JSON is valid YAML, so decode it as a node to keep the field order,
+	// clearing the JSON flow and quoting styles for block-style output.
+	var node yaml.Node
+	err = yaml.Unmarshal(data, &node)
+	if err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	clearYAMLStyle(&node)
+
+	out, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// clearYAMLStyle resets the style of node and its descendants to the default.
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// prefixWriter is an io.Writer that prefixes each line written to it before
+// passing it along to an underlying writer. Writers sharing a mutex can be
+// used concurrently without interleaving partial lines.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:      w,
+		mu:     mu,
+		prefix: []byte(prefix),
+	}
+}
+
+// Write buffers b and writes out every complete line.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes out any buffered partial line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit identify the microleaf build. They're set at build time
+// with, e.g.:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "unknown"
+	commit  = "unknown"
+)
+
+// buildVersion returns the version and commit of the running binary. Values
+// not set with -ldflags are taken from the build info embedded by the Go
+// toolchain, where available.
+func buildVersion() (string, string) {
+	v, c := version, commit
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v, c
+	}
+
+	if v == "unknown" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	if c == "unknown" {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				c = setting.Value[:7]
+			}
+		}
+	}
+	return v, c
+}
+
+func doVersionCommand(args []string) {
+	if len(args) != 0 {
+		fmt.Println("usage: microleaf [-json] version")
+		os.Exit(1)
+	}
+
+	v, c := buildVersion()
+	if *jsonOutput {
+		err := printJSON(os.Stdout, map[string]string{
+			"version": v,
+			"commit":  c,
+			"go":      runtime.Version(),
+		})
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("microleaf %s (commit %s, %s)\n", v, c, runtime.Version())
+}